@@ -47,20 +47,186 @@ func main() {
 				// flag : -ew <end word>
 				// flag : -r <subst file>
 				Name:  "replace",
-				Usage: "Usage: <program> replace -f <file list> -o <out dir> -bw <begin word> -ew <end word> -r <sutst file> [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Usage: "Usage: <program> replace -f <file list> -o <out dir> {-bw <begin word> | --bw-re <regexp>} {-ew <end word> | --ew-re <regexp>} | {--module <name> | --primitive <name>}... [--nested] [--marker <text>] {-r <sutst file> [--src-unit <name>] | --text <text>} [--check-ports error|warn] [--verbose <level>] [-tofile] <files1> <file2> ...",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:     "bw",
-						Value:    "begin",
-						Usage:    "begin word",
+						Name:  "bw",
+						Usage: "begin word",
+					},
+					&cli.StringFlag{
+						Name:  "ew",
+						Usage: "end word",
+					},
+					&cli.StringFlag{
+						Name:  "bw-re",
+						Usage: "begin regular expression, its named groups are referred to as ${name}",
+					},
+					&cli.StringFlag{
+						Name:  "ew-re",
+						Usage: "end regular expression, its named groups are referred to as ${name}",
+					},
+					&cli.BoolFlag{
+						Name:  "nested",
+						Value: false,
+						Usage: "pair each begin word with its balanced end word",
+					},
+					&cli.StringFlag{
+						Name:  "marker",
+						Usage: "text of the comment left in place of the block",
+					},
+					&cli.StringSliceFlag{
+						Name:  "module",
+						Usage: "name or glob pattern of a module to act on instead of -bw/-ew, can be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "primitive",
+						Usage: "name or glob pattern of a primitive to act on instead of -bw/-ew, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:     "f",
+						Value:    "filelist",
+						Usage:    "file list",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:  "r",
+						Usage: "substitution file",
+					},
+					&cli.StringFlag{
+						Name:  "text",
+						Usage: "substitution text given instead of -r, may span several lines",
+					},
+					&cli.StringFlag{
+						Name:  "src-unit",
+						Usage: "name of the module or primitive of the substitution file to use, by default the one named like the replaced module",
+					},
+					&cli.StringFlag{
+						Name:  "check-ports",
+						Usage: "compare the ports of the replaced modules with the replacement and fail (error) or warn (warn) when they differ",
+					},
+					&cli.StringFlag{
+						Name:     "o",
+						Value:    "newout",
+						Usage:    "output directory",
 						Required: true,
 					},
 					&cli.StringFlag{
-						Name:     "ew",
-						Value:    "end",
-						Usage:    "end word",
+						Name:  "verbose",
+						Value: "info",
+						Usage: "set the log level (debug, info, warn, error, fatal, panic)",
+					},
+					&cli.BoolFlag{
+						Name:  "tofile",
+						Value: false,
+						Usage: "redirect the log into the file log/vmod.log",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					op := vtext.Opcode{
+						Begin:      c.String("bw"),
+						End:        c.String("ew"),
+						BeginRe:    c.String("bw-re"),
+						EndRe:      c.String("ew-re"),
+						Src:        c.String("r"),
+						Text:       vtext.Lines(c.String("text")),
+						Nested:     c.Bool("nested"),
+						Marker:     c.String("marker"),
+						CheckPorts: c.String("check-ports"),
+						SrcUnit:    c.String("src-unit"),
+					}
+					if op.Src == "" && op.Text == "" {
+						return fmt.Errorf("either -r or --text is required")
+					}
+					fileList := c.String("f")
+					outDir := c.String("o")
+					tofile := c.Bool("tofile")
+					files := c.Args().Slice()
+
+					// Parse the log level from the command-line flag
+					level, err := log.ParseLevel(c.String("verbose"))
+					if err != nil {
+						return err
+					}
+
+					if tofile {
+						// create log directory
+						if err = helper.CreateOutputDir("log"); err != nil {
+							panic(err)
+						}
+
+						// Open the log file
+						logfile, err := os.OpenFile("log/vmod.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+						if err != nil {
+							log.Fatal(err)
+						}
+						defer logfile.Close()
+
+						// Set the logger output to the log file
+						log.SetOutput(logfile)
+					}
+
+					// Set the log level
+					log.SetLevel(level)
+
+					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
+						logFileListError(fileList, err)
+					} else {
+						files = append(files, fileFromLists...)
+					}
+
+					ops, err := unitOpcodes(c, op)
+					if err != nil {
+						return err
+					}
+					vtext.ReplaceHelper(files, ops, outDir)
+					return nil
+				},
+			},
+			{
+				// add command insert
+				// flag : -f <file list>
+				// flag : -o <output directory>
+				// flag : -bw <begin word>
+				// flag : -ew <end word>
+				// flag : --at <position>
+				// flag : -r <insert file>
+				Name:  "insert",
+				Usage: "Usage: <program> insert -f <file list> -o <out dir> {-bw <begin word> | --bw-re <regexp>} {-ew <end word> | --ew-re <regexp>} | {--module <name> | --primitive <name>}... [--nested] --at before|after|start|end {-r <insert file> | --text <text>} [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "bw",
+						Usage: "begin word",
+					},
+					&cli.StringFlag{
+						Name:  "ew",
+						Usage: "end word",
+					},
+					&cli.StringFlag{
+						Name:  "bw-re",
+						Usage: "begin regular expression, its named groups are referred to as ${name}",
+					},
+					&cli.StringFlag{
+						Name:  "ew-re",
+						Usage: "end regular expression, its named groups are referred to as ${name}",
+					},
+					&cli.BoolFlag{
+						Name:  "nested",
+						Value: false,
+						Usage: "pair each begin word with its balanced end word",
+					},
+					&cli.StringFlag{
+						Name:     "at",
+						Usage:    "where to insert the text: before or after the block, at the start (after the module header) or at the end (before endmodule) of the block",
 						Required: true,
 					},
+					&cli.StringSliceFlag{
+						Name:  "module",
+						Usage: "name or glob pattern of a module to act on instead of -bw/-ew, can be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "primitive",
+						Usage: "name or glob pattern of a primitive to act on instead of -bw/-ew, can be repeated",
+					},
 					&cli.StringFlag{
 						Name:     "f",
 						Value:    "filelist",
@@ -68,10 +234,12 @@ func main() {
 						Required: false,
 					},
 					&cli.StringFlag{
-						Name:     "r",
-						Value:    "repl.v",
-						Usage:    "substitution file",
-						Required: true,
+						Name:  "r",
+						Usage: "file of the text to insert",
+					},
+					&cli.StringFlag{
+						Name:  "text",
+						Usage: "text to insert given instead of -r, may span several lines",
 					},
 					&cli.StringFlag{
 						Name:     "o",
@@ -91,9 +259,18 @@ func main() {
 					},
 				},
 				Action: func(c *cli.Context) error {
-					bw := c.String("bw")
-					ew := c.String("ew")
-					repl := c.String("r")
+					op := vtext.Opcode{
+						Begin:   c.String("bw"),
+						End:     c.String("ew"),
+						BeginRe: c.String("bw-re"),
+						EndRe:   c.String("ew-re"),
+						Src:     c.String("r"),
+						Text:    vtext.Lines(c.String("text")),
+						Nested:  c.Bool("nested"),
+					}
+					if op.Src == "" && op.Text == "" {
+						return fmt.Errorf("either -r or --text is required")
+					}
 					fileList := c.String("f")
 					outDir := c.String("o")
 					tofile := c.Bool("tofile")
@@ -126,13 +303,16 @@ func main() {
 					log.SetLevel(level)
 
 					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
-						//fmt.Printf("can not open %s\n", fileList)
+						logFileListError(fileList, err)
 					} else {
 						files = append(files, fileFromLists...)
 					}
 
-					vtext.ReplaceHelper(files, bw, ew, repl, outDir)
-					return nil
+					ops, err := unitOpcodes(c, op)
+					if err != nil {
+						return err
+					}
+					return vtext.InsertHelper(files, ops, c.String("at"), outDir)
 				},
 			},
 			{
@@ -142,19 +322,48 @@ func main() {
 				// flag : -bw <begin word>
 				// flag : -ew <end word>
 				Name:  "dummy",
-				Usage: "Usage: <program> dummy -f <file list> -o <out dir> -bw <begin word> -ew <end word> [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Usage: "Usage: <program> dummy -f <file list> -o <out dir> {-bw <begin word> | --bw-re <regexp>} {-ew <end word> | --ew-re <regexp>} | {--module <name> | --primitive <name>}... [--nested] [--marker <text>] [--verbose <level>] [-tofile] <files1> <file2> ...",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:     "bw",
-						Value:    "begin",
-						Usage:    "begin word",
-						Required: true,
+						Name:  "bw",
+						Usage: "begin word",
 					},
 					&cli.StringFlag{
-						Name:     "ew",
-						Value:    "end",
-						Usage:    "end word",
-						Required: true,
+						Name:  "ew",
+						Usage: "end word",
+					},
+					&cli.StringFlag{
+						Name:  "bw-re",
+						Usage: "begin regular expression, its named groups are referred to as ${name}",
+					},
+					&cli.StringFlag{
+						Name:  "ew-re",
+						Usage: "end regular expression, its named groups are referred to as ${name}",
+					},
+					&cli.BoolFlag{
+						Name:  "nested",
+						Value: false,
+						Usage: "pair each begin word with its balanced end word",
+					},
+					&cli.StringFlag{
+						Name:  "marker",
+						Usage: "text of the comment left in place of the block",
+					},
+					&cli.StringSliceFlag{
+						Name:  "module",
+						Usage: "name or glob pattern of a module to act on instead of -bw/-ew, can be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "primitive",
+						Usage: "name or glob pattern of a primitive to act on instead of -bw/-ew, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:  "tie",
+						Usage: "drive the outputs of the dummy units: zero, one, x, z or passthrough-by-name",
+					},
+					&cli.StringSliceFlag{
+						Name:  "blackbox",
+						Usage: "mark the dummy units as black boxes for a tool (yosys, vivado, synplify, synopsys) or with an attribute, can be repeated",
 					},
 					&cli.StringFlag{
 						Name:     "f",
@@ -180,8 +389,16 @@ func main() {
 					},
 				},
 				Action: func(c *cli.Context) error {
-					bw := c.String("bw")
-					ew := c.String("ew")
+					op := vtext.Opcode{
+						Begin:    c.String("bw"),
+						End:      c.String("ew"),
+						BeginRe:  c.String("bw-re"),
+						EndRe:    c.String("ew-re"),
+						Nested:   c.Bool("nested"),
+						Marker:   c.String("marker"),
+						Tie:      c.String("tie"),
+						Blackbox: c.StringSlice("blackbox"),
+					}
 					fileList := c.String("f")
 					outDir := c.String("o")
 					tofile := c.Bool("tofile")
@@ -214,12 +431,16 @@ func main() {
 					log.SetLevel(level)
 
 					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
-						//fmt.Printf("can not open %s\n", fileList)
+						logFileListError(fileList, err)
 					} else {
 						files = append(files, fileFromLists...)
 					}
 
-					vtext.DummyHelper(files, bw, ew, outDir)
+					ops, err := unitOpcodes(c, op)
+					if err != nil {
+						return err
+					}
+					vtext.DummyHelper(files, ops, outDir)
 					return nil
 				},
 			},
@@ -231,19 +452,40 @@ func main() {
 				// flag : -ew <end word>
 				// flag : -r <replacement file>
 				Name:  "remove",
-				Usage: "Usage: <program> remove -f <file list> -o <out dir> -bw <begin word> -ew <end word> [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Usage: "Usage: <program> remove -f <file list> -o <out dir> {-bw <begin word> | --bw-re <regexp>} {-ew <end word> | --ew-re <regexp>} | {--module <name> | --primitive <name>}... [--nested] [--marker <text>] [--verbose <level>] [-tofile] <files1> <file2> ...",
 				Flags: []cli.Flag{
 					&cli.StringFlag{
-						Name:     "bw",
-						Value:    "begin",
-						Usage:    "begin word",
-						Required: true,
+						Name:  "bw",
+						Usage: "begin word",
 					},
 					&cli.StringFlag{
-						Name:     "ew",
-						Value:    "end",
-						Usage:    "end word",
-						Required: true,
+						Name:  "ew",
+						Usage: "end word",
+					},
+					&cli.StringFlag{
+						Name:  "bw-re",
+						Usage: "begin regular expression, its named groups are referred to as ${name}",
+					},
+					&cli.StringFlag{
+						Name:  "ew-re",
+						Usage: "end regular expression, its named groups are referred to as ${name}",
+					},
+					&cli.BoolFlag{
+						Name:  "nested",
+						Value: false,
+						Usage: "pair each begin word with its balanced end word",
+					},
+					&cli.StringFlag{
+						Name:  "marker",
+						Usage: "text of the comment left in place of the block",
+					},
+					&cli.StringSliceFlag{
+						Name:  "module",
+						Usage: "name or glob pattern of a module to act on instead of -bw/-ew, can be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "primitive",
+						Usage: "name or glob pattern of a primitive to act on instead of -bw/-ew, can be repeated",
 					},
 					&cli.StringFlag{
 						Name:     "f",
@@ -269,8 +511,14 @@ func main() {
 					},
 				},
 				Action: func(c *cli.Context) error {
-					bw := c.String("bw")
-					ew := c.String("ew")
+					op := vtext.Opcode{
+						Begin:   c.String("bw"),
+						End:     c.String("ew"),
+						BeginRe: c.String("bw-re"),
+						EndRe:   c.String("ew-re"),
+						Nested:  c.Bool("nested"),
+						Marker:  c.String("marker"),
+					}
 					fileList := c.String("f")
 					outDir := c.String("o")
 					tofile := c.Bool("tofile")
@@ -303,12 +551,16 @@ func main() {
 					log.SetLevel(level)
 
 					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
-						//fmt.Printf("can not open %s\n", fileList)
+						logFileListError(fileList, err)
 					} else {
 						files = append(files, fileFromLists...)
 					}
 
-					vtext.RemoveHelper(files, bw, ew, outDir)
+					ops, err := unitOpcodes(c, op)
+					if err != nil {
+						return err
+					}
+					vtext.RemoveHelper(files, ops, outDir)
 					return nil
 				},
 			},
@@ -385,7 +637,7 @@ func main() {
 					log.SetLevel(level)
 
 					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
-						//fmt.Printf("can not open %s\n", fileList)
+						logFileListError(fileList, err)
 					} else {
 						files = append(files, fileFromLists...)
 					}
@@ -395,15 +647,38 @@ func main() {
 				},
 			},
 			{
-				Name:  "chain",
-				Usage: "Usage: <program> chain -c <json> -f <file list> -o <out dir> [--verbose <level>] [-tofile]",
+				// add command addport
+				// flag : -f <file list>
+				// flag : -o <output directory>
+				// flag : --module <module>
+				// flag : --port <port>
+				// flag : --net <net>
+				Name:  "addport",
+				Usage: "Usage: <program> addport -f <file list> -o <out dir> --module <name>... --port <port> [--dir input|output|inout] [--range <msb:lsb>] [--net <net>] [--verbose <level>] [-tofile] <files1> <file2> ...",
 				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "module",
+						Usage:    "name or glob pattern of a module to add the port to, can be repeated",
+						Required: true,
+					},
 					&cli.StringFlag{
-						Name:     "c",
-						Value:    "vmod.json",
-						Usage:    "config file",
+						Name:     "port",
+						Usage:    "name of the port",
 						Required: true,
 					},
+					&cli.StringFlag{
+						Name:  "dir",
+						Value: "input",
+						Usage: "direction of the port",
+					},
+					&cli.StringFlag{
+						Name:  "range",
+						Usage: "packed range of the port, e.g. 3:0",
+					},
+					&cli.StringFlag{
+						Name:  "net",
+						Usage: "net connected to the port at the instances of the module, not connected when empty",
+					},
 					&cli.StringFlag{
 						Name:     "f",
 						Value:    "filelist",
@@ -428,7 +703,12 @@ func main() {
 					},
 				},
 				Action: func(c *cli.Context) error {
-					configFile := c.String("c")
+					op := vtext.Opcode{
+						Port:  c.String("port"),
+						Dir:   c.String("dir"),
+						Range: c.String("range"),
+						Net:   c.String("net"),
+					}
 					fileList := c.String("f")
 					outDir := c.String("o")
 					tofile := c.Bool("tofile")
@@ -461,25 +741,1115 @@ func main() {
 					log.SetLevel(level)
 
 					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
-						//fmt.Printf("can not open %s\n", fileList)
+						logFileListError(fileList, err)
 					} else {
 						files = append(files, fileFromLists...)
 					}
 
-					vtext.ChainHelper(configFile, files, outDir)
+					ops, err := unitOpcodes(c, op)
+					if err != nil {
+						return err
+					}
+					vtext.AddPortHelper(files, ops, outDir)
 					return nil
 				},
 			},
-		},
-		Action: func(c *cli.Context) error {
-			cli.ShowAppHelp(c)
-			return nil
-		},
-	}
+			{
+				// add command rminst
+				// flag : -f <file list>
+				// flag : -o <output directory>
+				// flag : --module <module>
+				// flag : --inst <instance>
+				Name:  "rminst",
+				Usage: "Usage: <program> rminst -f <file list> -o <out dir> {--inst <top.path.instance> | --module <name>... --inst <instance>} [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "module",
+						Usage: "name or glob pattern of a module declaring the instances, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:     "inst",
+						Usage:    "hierarchical name of the instance to remove from the top module, or name or glob pattern of the instances of the modules",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "f",
+						Value:    "filelist",
+						Usage:    "file list",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "o",
+						Value:    "newout",
+						Usage:    "output directory",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "verbose",
+						Value: "info",
+						Usage: "set the log level (debug, info, warn, error, fatal, panic)",
+					},
+					&cli.BoolFlag{
+						Name:  "tofile",
+						Value: false,
+						Usage: "redirect the log into the file log/vmod.log",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					op := vtext.Opcode{
+						Instance: c.String("inst"),
+						To:       c.String("to"),
+					}
+					fileList := c.String("f")
+					outDir := c.String("o")
+					tofile := c.Bool("tofile")
+					files := c.Args().Slice()
 
-	err := app.Run(os.Args)
-	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(1)
+					// Parse the log level from the command-line flag
+					level, err := log.ParseLevel(c.String("verbose"))
+					if err != nil {
+						return err
+					}
+
+					if tofile {
+						// create log directory
+						if err = helper.CreateOutputDir("log"); err != nil {
+							panic(err)
+						}
+
+						// Open the log file
+						logfile, err := os.OpenFile("log/vmod.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+						if err != nil {
+							log.Fatal(err)
+						}
+						defer logfile.Close()
+
+						// Set the logger output to the log file
+						log.SetOutput(logfile)
+					}
+
+					// Set the log level
+					log.SetLevel(level)
+
+					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
+						logFileListError(fileList, err)
+					} else {
+						files = append(files, fileFromLists...)
+					}
+
+					ops := []vtext.Opcode{op}
+					if len(c.StringSlice("module")) > 0 {
+						if ops, err = unitOpcodes(c, op); err != nil {
+							return err
+						}
+					}
+					vtext.InstanceHelper(files, ops, "rminst", outDir)
+					return nil
+				},
+			},
+			{
+				// add command renameinst
+				// flag : -f <file list>
+				// flag : -o <output directory>
+				// flag : --module <module>
+				// flag : --inst <instance>
+				// flag : --to <name>
+				Name:  "renameinst",
+				Usage: "Usage: <program> renameinst -f <file list> -o <out dir> {--inst <top.path.instance> | --module <name>... --inst <instance>} --to <name> [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "module",
+						Usage: "name or glob pattern of a module declaring the instances, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:     "inst",
+						Usage:    "hierarchical name of the instance to rename from the top module, or name or glob pattern of the instances of the modules",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "to",
+						Usage:    "new name of the instances",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "f",
+						Value:    "filelist",
+						Usage:    "file list",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "o",
+						Value:    "newout",
+						Usage:    "output directory",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "verbose",
+						Value: "info",
+						Usage: "set the log level (debug, info, warn, error, fatal, panic)",
+					},
+					&cli.BoolFlag{
+						Name:  "tofile",
+						Value: false,
+						Usage: "redirect the log into the file log/vmod.log",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					op := vtext.Opcode{
+						Instance: c.String("inst"),
+						To:       c.String("to"),
+					}
+					fileList := c.String("f")
+					outDir := c.String("o")
+					tofile := c.Bool("tofile")
+					files := c.Args().Slice()
+
+					// Parse the log level from the command-line flag
+					level, err := log.ParseLevel(c.String("verbose"))
+					if err != nil {
+						return err
+					}
+
+					if tofile {
+						// create log directory
+						if err = helper.CreateOutputDir("log"); err != nil {
+							panic(err)
+						}
+
+						// Open the log file
+						logfile, err := os.OpenFile("log/vmod.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+						if err != nil {
+							log.Fatal(err)
+						}
+						defer logfile.Close()
+
+						// Set the logger output to the log file
+						log.SetOutput(logfile)
+					}
+
+					// Set the log level
+					log.SetLevel(level)
+
+					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
+						logFileListError(fileList, err)
+					} else {
+						files = append(files, fileFromLists...)
+					}
+
+					ops := []vtext.Opcode{op}
+					if len(c.StringSlice("module")) > 0 {
+						if ops, err = unitOpcodes(c, op); err != nil {
+							return err
+						}
+					}
+					vtext.InstanceHelper(files, ops, "renameinst", outDir)
+					return nil
+				},
+			},
+			{
+				// add command remaster
+				// flag : -f <file list>
+				// flag : -o <output directory>
+				// flag : --module <module>
+				// flag : --inst <instance>
+				// flag : --to <master>
+				Name:  "remaster",
+				Usage: "Usage: <program> remaster -f <file list> -o <out dir> {--inst <top.path.instance> | --module <name>... --inst <instance>} --to <master> [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "module",
+						Usage: "name or glob pattern of a module declaring the instances, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:     "inst",
+						Usage:    "hierarchical name of the instance to change the master of from the top module, or name or glob pattern of the instances of the modules",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "to",
+						Usage:    "new master of the instances",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "f",
+						Value:    "filelist",
+						Usage:    "file list",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "o",
+						Value:    "newout",
+						Usage:    "output directory",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "verbose",
+						Value: "info",
+						Usage: "set the log level (debug, info, warn, error, fatal, panic)",
+					},
+					&cli.BoolFlag{
+						Name:  "tofile",
+						Value: false,
+						Usage: "redirect the log into the file log/vmod.log",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					op := vtext.Opcode{
+						Instance: c.String("inst"),
+						To:       c.String("to"),
+					}
+					fileList := c.String("f")
+					outDir := c.String("o")
+					tofile := c.Bool("tofile")
+					files := c.Args().Slice()
+
+					// Parse the log level from the command-line flag
+					level, err := log.ParseLevel(c.String("verbose"))
+					if err != nil {
+						return err
+					}
+
+					if tofile {
+						// create log directory
+						if err = helper.CreateOutputDir("log"); err != nil {
+							panic(err)
+						}
+
+						// Open the log file
+						logfile, err := os.OpenFile("log/vmod.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+						if err != nil {
+							log.Fatal(err)
+						}
+						defer logfile.Close()
+
+						// Set the logger output to the log file
+						log.SetOutput(logfile)
+					}
+
+					// Set the log level
+					log.SetLevel(level)
+
+					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
+						logFileListError(fileList, err)
+					} else {
+						files = append(files, fileFromLists...)
+					}
+
+					ops := []vtext.Opcode{op}
+					if len(c.StringSlice("module")) > 0 {
+						if ops, err = unitOpcodes(c, op); err != nil {
+							return err
+						}
+					}
+					vtext.InstanceHelper(files, ops, "remaster", outDir)
+					return nil
+				},
+			},
+			{
+				// add command removeport
+				// flag : -f <file list>
+				// flag : -o <output directory>
+				// flag : --module <module>
+				// flag : --port <port>
+				// flag : --tie <value>
+				Name:  "removeport",
+				Usage: "Usage: <program> removeport -f <file list> -o <out dir> --module <name>... --port <port> [--tie zero|one|x|z] [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "module",
+						Usage:    "name or glob pattern of a module to remove the port from, can be repeated",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "port",
+						Usage:    "name of the port to remove",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "tie",
+						Usage: "value driving the former input port inside the modules (zero, one, x, z), undriven when empty",
+					},
+					&cli.StringFlag{
+						Name:     "f",
+						Value:    "filelist",
+						Usage:    "file list",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "o",
+						Value:    "newout",
+						Usage:    "output directory",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "verbose",
+						Value: "info",
+						Usage: "set the log level (debug, info, warn, error, fatal, panic)",
+					},
+					&cli.BoolFlag{
+						Name:  "tofile",
+						Value: false,
+						Usage: "redirect the log into the file log/vmod.log",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					op := vtext.Opcode{
+						Port: c.String("port"),
+						Tie:  c.String("tie"),
+					}
+					fileList := c.String("f")
+					outDir := c.String("o")
+					tofile := c.Bool("tofile")
+					files := c.Args().Slice()
+
+					// Parse the log level from the command-line flag
+					level, err := log.ParseLevel(c.String("verbose"))
+					if err != nil {
+						return err
+					}
+
+					if tofile {
+						// create log directory
+						if err = helper.CreateOutputDir("log"); err != nil {
+							panic(err)
+						}
+
+						// Open the log file
+						logfile, err := os.OpenFile("log/vmod.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+						if err != nil {
+							log.Fatal(err)
+						}
+						defer logfile.Close()
+
+						// Set the logger output to the log file
+						log.SetOutput(logfile)
+					}
+
+					// Set the log level
+					log.SetLevel(level)
+
+					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
+						logFileListError(fileList, err)
+					} else {
+						files = append(files, fileFromLists...)
+					}
+
+					ops, err := unitOpcodes(c, op)
+					if err != nil {
+						return err
+					}
+					vtext.RemovePortHelper(files, ops, outDir)
+					return nil
+				},
+			},
+			{
+				// add command tieport
+				// flag : -f <file list>
+				// flag : -o <output directory>
+				// flag : --module <module>
+				// flag : --port <port>
+				// flag : --tie <value>
+				Name:  "tieport",
+				Usage: "Usage: <program> tieport -f <file list> -o <out dir> --module <name>... --port <port> [--tie zero|one|x|z] [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "module",
+						Usage:    "name or glob pattern of a module to tie the port of, can be repeated",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "port",
+						Usage:    "name of the port to tie",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "tie",
+						Usage: "value tying the input port at the instances (zero, one, x, z), zero by default",
+					},
+					&cli.StringFlag{
+						Name:     "f",
+						Value:    "filelist",
+						Usage:    "file list",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "o",
+						Value:    "newout",
+						Usage:    "output directory",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "verbose",
+						Value: "info",
+						Usage: "set the log level (debug, info, warn, error, fatal, panic)",
+					},
+					&cli.BoolFlag{
+						Name:  "tofile",
+						Value: false,
+						Usage: "redirect the log into the file log/vmod.log",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					op := vtext.Opcode{
+						Port: c.String("port"),
+						Tie:  c.String("tie"),
+					}
+					fileList := c.String("f")
+					outDir := c.String("o")
+					tofile := c.Bool("tofile")
+					files := c.Args().Slice()
+
+					// Parse the log level from the command-line flag
+					level, err := log.ParseLevel(c.String("verbose"))
+					if err != nil {
+						return err
+					}
+
+					if tofile {
+						// create log directory
+						if err = helper.CreateOutputDir("log"); err != nil {
+							panic(err)
+						}
+
+						// Open the log file
+						logfile, err := os.OpenFile("log/vmod.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+						if err != nil {
+							log.Fatal(err)
+						}
+						defer logfile.Close()
+
+						// Set the logger output to the log file
+						log.SetOutput(logfile)
+					}
+
+					// Set the log level
+					log.SetLevel(level)
+
+					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
+						logFileListError(fileList, err)
+					} else {
+						files = append(files, fileFromLists...)
+					}
+
+					ops, err := unitOpcodes(c, op)
+					if err != nil {
+						return err
+					}
+					vtext.TiePortHelper(files, ops, outDir)
+					return nil
+				},
+			},
+			{
+				// add command setparam
+				// flag : -f <file list>
+				// flag : -o <output directory>
+				// flag : --module <module>
+				// flag : --param <parameter>
+				// flag : --value <value>
+				Name:  "setparam",
+				Usage: "Usage: <program> setparam -f <file list> -o <out dir> --module <name>... --param <parameter> --value <value> [--overrides] [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "module",
+						Usage:    "name or glob pattern of a module to set the parameter of, can be repeated",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "param",
+						Usage:    "name of the parameter",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "value",
+						Usage:    "new default value of the parameter",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:  "overrides",
+						Value: false,
+						Usage: "set the value of the named overrides of the parameter at the instances too",
+					},
+					&cli.StringFlag{
+						Name:     "f",
+						Value:    "filelist",
+						Usage:    "file list",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "o",
+						Value:    "newout",
+						Usage:    "output directory",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "verbose",
+						Value: "info",
+						Usage: "set the log level (debug, info, warn, error, fatal, panic)",
+					},
+					&cli.BoolFlag{
+						Name:  "tofile",
+						Value: false,
+						Usage: "redirect the log into the file log/vmod.log",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					op := vtext.Opcode{
+						Param:     c.String("param"),
+						Value:     c.String("value"),
+						Overrides: c.Bool("overrides"),
+					}
+					fileList := c.String("f")
+					outDir := c.String("o")
+					tofile := c.Bool("tofile")
+					files := c.Args().Slice()
+
+					// Parse the log level from the command-line flag
+					level, err := log.ParseLevel(c.String("verbose"))
+					if err != nil {
+						return err
+					}
+
+					if tofile {
+						// create log directory
+						if err = helper.CreateOutputDir("log"); err != nil {
+							panic(err)
+						}
+
+						// Open the log file
+						logfile, err := os.OpenFile("log/vmod.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+						if err != nil {
+							log.Fatal(err)
+						}
+						defer logfile.Close()
+
+						// Set the logger output to the log file
+						log.SetOutput(logfile)
+					}
+
+					// Set the log level
+					log.SetLevel(level)
+
+					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
+						logFileListError(fileList, err)
+					} else {
+						files = append(files, fileFromLists...)
+					}
+
+					ops, err := unitOpcodes(c, op)
+					if err != nil {
+						return err
+					}
+					vtext.SetParamHelper(files, ops, outDir)
+					return nil
+				},
+			},
+			{
+				// add command renamenet
+				// flag : -f <file list>
+				// flag : -o <output directory>
+				// flag : --module <module>
+				// flag : --from <old name>
+				// flag : --to <new name>
+				Name:  "renamenet",
+				Usage: "Usage: <program> renamenet -f <file list> -o <out dir> --module <name>... --from <old name> --to <new name> [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "module",
+						Usage:    "name or glob pattern of a module to rename the net in, can be repeated",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "from",
+						Usage:    "name of the net to rename",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "to",
+						Usage:    "new name of the net",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "f",
+						Value:    "filelist",
+						Usage:    "file list",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "o",
+						Value:    "newout",
+						Usage:    "output directory",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "verbose",
+						Value: "info",
+						Usage: "set the log level (debug, info, warn, error, fatal, panic)",
+					},
+					&cli.BoolFlag{
+						Name:  "tofile",
+						Value: false,
+						Usage: "redirect the log into the file log/vmod.log",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					op := vtext.Opcode{
+						From: c.String("from"),
+						To:   c.String("to"),
+					}
+					fileList := c.String("f")
+					outDir := c.String("o")
+					tofile := c.Bool("tofile")
+					files := c.Args().Slice()
+
+					// Parse the log level from the command-line flag
+					level, err := log.ParseLevel(c.String("verbose"))
+					if err != nil {
+						return err
+					}
+
+					if tofile {
+						// create log directory
+						if err = helper.CreateOutputDir("log"); err != nil {
+							panic(err)
+						}
+
+						// Open the log file
+						logfile, err := os.OpenFile("log/vmod.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+						if err != nil {
+							log.Fatal(err)
+						}
+						defer logfile.Close()
+
+						// Set the logger output to the log file
+						log.SetOutput(logfile)
+					}
+
+					// Set the log level
+					log.SetLevel(level)
+
+					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
+						logFileListError(fileList, err)
+					} else {
+						files = append(files, fileFromLists...)
+					}
+
+					ops, err := unitOpcodes(c, op)
+					if err != nil {
+						return err
+					}
+					vtext.RenameNetHelper(files, ops, outDir)
+					return nil
+				},
+			},
+			{
+				// add command reconnect
+				// flag : -f <file list>
+				// flag : -o <output directory>
+				// flag : --module <module>
+				// flag : --inst <instance>
+				// flag : --port <pin>
+				// flag : --net <net>
+				Name:  "reconnect",
+				Usage: "Usage: <program> reconnect -f <file list> -o <out dir> {--inst <top.path.instance> | --module <name>... --inst <instance>} --port <pin> --net <net> [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "module",
+						Usage: "name or glob pattern of a module declaring the instances, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:     "inst",
+						Usage:    "hierarchical name of the instance to reconnect from the top module, or name or glob pattern of the instances of the modules",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "port",
+						Usage:    "pin of the instances to reconnect",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "net",
+						Usage: "net connected to the pin, left unconnected when empty",
+					},
+					&cli.StringFlag{
+						Name:     "f",
+						Value:    "filelist",
+						Usage:    "file list",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "o",
+						Value:    "newout",
+						Usage:    "output directory",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "verbose",
+						Value: "info",
+						Usage: "set the log level (debug, info, warn, error, fatal, panic)",
+					},
+					&cli.BoolFlag{
+						Name:  "tofile",
+						Value: false,
+						Usage: "redirect the log into the file log/vmod.log",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					op := vtext.Opcode{
+						Instance: c.String("inst"),
+						Port:     c.String("port"),
+						Net:      c.String("net"),
+					}
+					fileList := c.String("f")
+					outDir := c.String("o")
+					tofile := c.Bool("tofile")
+					files := c.Args().Slice()
+
+					// Parse the log level from the command-line flag
+					level, err := log.ParseLevel(c.String("verbose"))
+					if err != nil {
+						return err
+					}
+
+					if tofile {
+						// create log directory
+						if err = helper.CreateOutputDir("log"); err != nil {
+							panic(err)
+						}
+
+						// Open the log file
+						logfile, err := os.OpenFile("log/vmod.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+						if err != nil {
+							log.Fatal(err)
+						}
+						defer logfile.Close()
+
+						// Set the logger output to the log file
+						log.SetOutput(logfile)
+					}
+
+					// Set the log level
+					log.SetLevel(level)
+
+					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
+						logFileListError(fileList, err)
+					} else {
+						files = append(files, fileFromLists...)
+					}
+
+					ops := []vtext.Opcode{op}
+					if len(c.StringSlice("module")) > 0 {
+						if ops, err = unitOpcodes(c, op); err != nil {
+							return err
+						}
+					}
+					vtext.ReconnectHelper(files, ops, outDir)
+					return nil
+				},
+			},
+			{
+				// add command rename
+				// flag : -f <file list>
+				// flag : -o <output directory>
+				// flag : --from <old name>
+				// flag : --to <new name>
+				Name:  "rename",
+				Usage: "Usage: <program> rename -f <file list> -o <out dir> --from <old name> --to <new name> [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "from",
+						Usage:    "name of the module to rename",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "to",
+						Usage:    "new name of the module",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "f",
+						Value:    "filelist",
+						Usage:    "file list",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "o",
+						Value:    "newout",
+						Usage:    "output directory",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "verbose",
+						Value: "info",
+						Usage: "set the log level (debug, info, warn, error, fatal, panic)",
+					},
+					&cli.BoolFlag{
+						Name:  "tofile",
+						Value: false,
+						Usage: "redirect the log into the file log/vmod.log",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					from := c.String("from")
+					to := c.String("to")
+					fileList := c.String("f")
+					outDir := c.String("o")
+					tofile := c.Bool("tofile")
+					files := c.Args().Slice()
+
+					// Parse the log level from the command-line flag
+					level, err := log.ParseLevel(c.String("verbose"))
+					if err != nil {
+						return err
+					}
+
+					if tofile {
+						// create log directory
+						if err = helper.CreateOutputDir("log"); err != nil {
+							panic(err)
+						}
+
+						// Open the log file
+						logfile, err := os.OpenFile("log/vmod.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+						if err != nil {
+							log.Fatal(err)
+						}
+						defer logfile.Close()
+
+						// Set the logger output to the log file
+						log.SetOutput(logfile)
+					}
+
+					// Set the log level
+					log.SetLevel(level)
+
+					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
+						logFileListError(fileList, err)
+					} else {
+						files = append(files, fileFromLists...)
+					}
+
+					vtext.RenameHelper(files, from, to, outDir)
+					return nil
+				},
+			},
+			{
+				// add command uniquify
+				// flag : -f <file list>
+				// flag : -o <output directory>
+				// flag : --prefix <prefix>
+				// flag : --suffix <suffix>
+				Name:  "uniquify",
+				Usage: "Usage: <program> uniquify -f <file list> -o <out dir> {--prefix <prefix> | --suffix <suffix>} [--verbose <level>] [-tofile] <files1> <file2> ...",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "prefix",
+						Usage: "prefix added to the name of every module and primitive",
+					},
+					&cli.StringFlag{
+						Name:  "suffix",
+						Usage: "suffix added to the name of every module and primitive",
+					},
+					&cli.StringFlag{
+						Name:     "f",
+						Value:    "filelist",
+						Usage:    "file list",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "o",
+						Value:    "newout",
+						Usage:    "output directory",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "verbose",
+						Value: "info",
+						Usage: "set the log level (debug, info, warn, error, fatal, panic)",
+					},
+					&cli.BoolFlag{
+						Name:  "tofile",
+						Value: false,
+						Usage: "redirect the log into the file log/vmod.log",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					prefix := c.String("prefix")
+					suffix := c.String("suffix")
+					if prefix == "" && suffix == "" {
+						return fmt.Errorf("either --prefix or --suffix is required")
+					}
+					fileList := c.String("f")
+					outDir := c.String("o")
+					tofile := c.Bool("tofile")
+					files := c.Args().Slice()
+
+					// Parse the log level from the command-line flag
+					level, err := log.ParseLevel(c.String("verbose"))
+					if err != nil {
+						return err
+					}
+
+					if tofile {
+						// create log directory
+						if err = helper.CreateOutputDir("log"); err != nil {
+							panic(err)
+						}
+
+						// Open the log file
+						logfile, err := os.OpenFile("log/vmod.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+						if err != nil {
+							log.Fatal(err)
+						}
+						defer logfile.Close()
+
+						// Set the logger output to the log file
+						log.SetOutput(logfile)
+					}
+
+					// Set the log level
+					log.SetLevel(level)
+
+					if fileFromLists, err := helper.ReadFiles(fileList); err != nil {
+						logFileListError(fileList, err)
+					} else {
+						files = append(files, fileFromLists...)
+					}
+
+					vtext.UniquifyHelper(files, prefix, suffix, outDir)
+					return nil
+				},
+			},
+			{
+				Name:  "chain",
+				Usage: "Usage: <program> chain -c <json> -f <file list> -o <out dir> [--define <NAME[=VALUE]>] [--incdir <dir>] [--verbose <level>] [-tofile]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "c",
+						Value:    "vmod.json",
+						Usage:    "config file",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "f",
+						Value:    "filelist",
+						Usage:    "file list",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "o",
+						Value:    "newout",
+						Usage:    "output directory",
+						Required: true,
+					},
+					&cli.StringSliceFlag{
+						Name:  "define",
+						Usage: "macro NAME or NAME=VALUE for the preprocessed opcodes, like +define+, can be repeated",
+					},
+					&cli.StringSliceFlag{
+						Name:  "incdir",
+						Usage: "include directory for the preprocessed opcodes, like +incdir+, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:  "verbose",
+						Value: "info",
+						Usage: "set the log level (debug, info, warn, error, fatal, panic)",
+					},
+					&cli.BoolFlag{
+						Name:  "tofile",
+						Value: false,
+						Usage: "redirect the log into the file log/vmod.log",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					configFile := c.String("c")
+					fileList := c.String("f")
+					outDir := c.String("o")
+					tofile := c.Bool("tofile")
+					files := c.Args().Slice()
+
+					// Parse the log level from the command-line flag
+					level, err := log.ParseLevel(c.String("verbose"))
+					if err != nil {
+						return err
+					}
+
+					if tofile {
+						// create log directory
+						if err = helper.CreateOutputDir("log"); err != nil {
+							panic(err)
+						}
+
+						// Open the log file
+						logfile, err := os.OpenFile("log/vmod.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+						if err != nil {
+							log.Fatal(err)
+						}
+						defer logfile.Close()
+
+						// Set the logger output to the log file
+						log.SetOutput(logfile)
+					}
+
+					// Set the log level
+					log.SetLevel(level)
+
+					defines := c.StringSlice("define")
+					incDirs := c.StringSlice("incdir")
+					if fl, err := helper.ParseFileList(fileList); err != nil {
+						logFileListError(fileList, err)
+					} else {
+						files = append(files, fl.Files...)
+						files = append(files, fl.ResolveLibraries(files)...)
+						defines = append(fl.Defines, defines...)
+						incDirs = append(fl.IncDirs, incDirs...)
+					}
+
+					vtext.ChainHelper(configFile, files, defines, incDirs, outDir)
+					return nil
+				},
+			},
+		},
+		Action: func(c *cli.Context) error {
+			cli.ShowAppHelp(c)
+			return nil
+		},
+	}
+
+	err := app.Run(os.Args)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+}
+
+// unitOpcodes returns one copy of op per --module and --primitive given on the
+// command line, or op itself when none is given.
+func unitOpcodes(c *cli.Context, op vtext.Opcode) ([]vtext.Opcode, error) {
+	var ops []vtext.Opcode
+	for _, kind := range []string{"module", "primitive"} {
+		for _, name := range c.StringSlice(kind) {
+			unitOp := op
+			unitOp.Unit = &vtext.Unit{Kind: kind, Name: name}
+			ops = append(ops, unitOp)
+		}
+	}
+	if len(ops) > 0 {
+		return ops, nil
+	}
+	if op.Begin == "" && op.BeginRe == "" {
+		return nil, fmt.Errorf("either -bw, --bw-re, --module or --primitive is required")
+	}
+	return []vtext.Opcode{op}, nil
+}
+
+// logFileListError reports the error reading the filelist, unless the
+// filelist does not exist, since -f defaults to one.
+func logFileListError(fileList string, err error) {
+	if _, statErr := os.Stat(fileList); os.IsNotExist(statErr) {
+		return
 	}
+	log.WithFields(log.Fields{
+		"fileList": fileList,
+		"error":    err,
+	}).Error("Error reading the filelist")
 }
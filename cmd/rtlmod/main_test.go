@@ -2,9 +2,11 @@ package main
 
 import (
 	"testing"
+
+	"github.com/zhuzhzh/vmod/internal/vtext"
 )
 
-func TestFindBeginEnd(t *testing.T) {
+func TestRemoveAction(t *testing.T) {
 	text := `This is some text with // a line <begin> comment
 // a line <end> comment
 and /* a block <begin> comment 
@@ -18,18 +20,13 @@ Here is the <begin> keyword.
 And here is the <end> keyword.`
 	t.Logf("text = \n%s\n", text)
 
-	beginIndex, endIndex := findBeginEnd(text, "<begin>", "<end>")
-
-	expectBegin := 134
-	expectEnd := 204
-
-	if beginIndex != expectBegin {
-		t.Errorf("Expected beginIndex to be %d, but got %d", expectBegin, beginIndex)
+	got, err := vtext.RemoveAction(text, vtext.Opcode{Begin: "<begin>", End: "<end>"})
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if endIndex != expectEnd {
-		t.Errorf("Expected endIndex to be %d, but got %d", expectEnd, endIndex)
+	expect := text[:134] + "// remove <begin>...<end>\n" + text[209:]
+	if got != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got)
 	}
-	t.Logf("begin = \n[%s]\n", text[beginIndex:])
-	t.Logf("end = \n[%s]\n", text[endIndex:])
 }
@@ -0,0 +1,135 @@
+package helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FileList is the content of a filelist in the format of the simulators.
+// The paths are relative to the directory of the filelist declaring them,
+// or absolute.
+type FileList struct {
+	// Files are the source files.
+	Files []string
+	// LibFiles are the library files given by -v.
+	LibFiles []string
+	// LibDirs are the library directories given by -y, searched for the
+	// files named like the missing modules with the extensions LibExts.
+	LibDirs []string
+	LibExts []string
+	// IncDirs are the include directories given by +incdir+.
+	IncDirs []string
+	// Defines are the macros given by +define+, as NAME or NAME=VALUE.
+	Defines []string
+}
+
+// ParseFileList reads the filelist fileList. It handles the nested filelists
+// given by -f or -F, the -v and -y libraries, and the +libext+, +incdir+ and
+// +define+ options. The // and # comments are skipped and the environment
+// variables like $HOME or ${HOME} are expanded. The other options are ignored.
+func ParseFileList(fileList string) (*FileList, error) {
+	fl := &FileList{}
+	if err := fl.parse(fileList, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return fl, nil
+}
+
+func (fl *FileList) parse(fileList string, reading map[string]bool) error {
+	abs, err := filepath.Abs(fileList)
+	if err != nil {
+		return err
+	}
+	if reading[abs] {
+		return fmt.Errorf("filelist %s includes itself", fileList)
+	}
+	reading[abs] = true
+	defer delete(reading, abs)
+
+	data, err := os.ReadFile(fileList)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(fileList)
+	args := fileListArgs(string(data))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "-f" || arg == "-F" || arg == "-v" || arg == "-y":
+			if i+1 == len(args) {
+				return fmt.Errorf("%s: missing argument after %s", fileList, arg)
+			}
+			i++
+			path := resolvePath(dir, args[i])
+			switch arg {
+			case "-v":
+				fl.LibFiles = append(fl.LibFiles, path)
+			case "-y":
+				fl.LibDirs = append(fl.LibDirs, path)
+			default:
+				if err := fl.parse(path, reading); err != nil {
+					return err
+				}
+			}
+		case strings.HasPrefix(arg, "+libext+"):
+			fl.LibExts = append(fl.LibExts, plusArgs(arg, "+libext+")...)
+		case strings.HasPrefix(arg, "+incdir+"):
+			for _, inc := range plusArgs(arg, "+incdir+") {
+				fl.IncDirs = append(fl.IncDirs, resolvePath(dir, inc))
+			}
+		case strings.HasPrefix(arg, "+define+"):
+			fl.Defines = append(fl.Defines, plusArgs(arg, "+define+")...)
+		case strings.HasPrefix(arg, "-") || strings.HasPrefix(arg, "+"):
+			log.WithFields(log.Fields{
+				"fileList": fileList,
+				"option":   arg,
+			}).Warn("Ignoring the unsupported filelist option")
+		default:
+			fl.Files = append(fl.Files, resolvePath(dir, arg))
+		}
+	}
+	return nil
+}
+
+// fileListArgs splits the filelist text into its arguments, dropping the
+// comments and expanding the environment variables.
+func fileListArgs(text string) []string {
+	var args []string
+	for _, line := range strings.Split(text, "\n") {
+		for _, arg := range strings.Fields(line) {
+			if strings.HasPrefix(arg, "//") || strings.HasPrefix(arg, "#") {
+				break
+			}
+			args = append(args, os.Expand(arg, func(name string) string {
+				if value, ok := os.LookupEnv(name); ok {
+					return value
+				}
+				return "${" + name + "}"
+			}))
+		}
+	}
+	return args
+}
+
+// plusArgs returns the values of the plus option arg, like +incdir+a+b.
+func plusArgs(arg string, prefix string) []string {
+	var values []string
+	for _, value := range strings.Split(strings.TrimPrefix(arg, prefix), "+") {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// resolvePath returns path relative to the directory dir of its filelist.
+func resolvePath(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(dir, path)
+}
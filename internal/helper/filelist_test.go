@@ -0,0 +1,60 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseFileList(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("IP_ROOT", "/opt/ip")
+	files := map[string]string{
+		"top.f": `// the design
+-f sub/sub.f
+top.v   # the top
+$IP_ROOT/core.v
+-v cells/lib.v
+-y cells +libext+.v+.sv
++incdir+include+${IP_ROOT}/include
++define+SYNTHESIS+WIDTH=8
+-sverilog
+`,
+		"sub/sub.f": `a.v
+/abs/b.v
+`,
+	}
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fl, err := ParseFileList(filepath.Join(dir, "top.f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &FileList{
+		Files:    []string{filepath.Join(dir, "sub/a.v"), "/abs/b.v", filepath.Join(dir, "top.v"), "/opt/ip/core.v"},
+		LibFiles: []string{filepath.Join(dir, "cells/lib.v")},
+		LibDirs:  []string{filepath.Join(dir, "cells")},
+		LibExts:  []string{".v", ".sv"},
+		IncDirs:  []string{filepath.Join(dir, "include"), "/opt/ip/include"},
+		Defines:  []string{"SYNTHESIS", "WIDTH=8"},
+	}
+	if !reflect.DeepEqual(fl, expect) {
+		t.Errorf("Expected %+v, got %+v", expect, fl)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "loop.f"), []byte("-f loop.f\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFileList(filepath.Join(dir, "loop.f")); err == nil {
+		t.Errorf("Expected an error for a filelist including itself")
+	}
+}
@@ -1,9 +1,7 @@
 package helper
 
 import (
-	"io/ioutil"
 	"os"
-	"strings"
 )
 
 func CreateOutputDir(outDir string) error {
@@ -16,12 +14,12 @@ func CreateOutputDir(outDir string) error {
 	return nil
 }
 
+// ReadFiles returns the source files of the filelist fileList, see
+// ParseFileList, and the library files declaring the units they instantiate.
 func ReadFiles(fileList string) ([]string, error) {
-	filesData, err := ioutil.ReadFile(fileList)
+	fl, err := ParseFileList(fileList)
 	if err != nil {
 		return nil, err
 	}
-
-	files := strings.Split(string(filesData), "\n")
-	return files, nil
+	return append(fl.Files, fl.ResolveLibraries(fl.Files)...), nil
 }
@@ -0,0 +1,110 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zhuzhzh/vmod/internal/vlex"
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+// library tracks the design units declared by the files of the set and the
+// masters instantiated but not declared yet.
+type library struct {
+	declared map[string]bool
+	missing  []string
+}
+
+// add records the units and the instances of the file, which is skipped when
+// it cannot be read.
+func (lib *library) add(file string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	f, _ := vparse.Parse(string(data))
+	for _, u := range f.Units {
+		lib.declared[u.Name] = true
+	}
+	for _, u := range f.Units {
+		for _, inst := range u.Instances {
+			if !lib.declared[inst.Master] && !vlex.IsKeyword(inst.Master) {
+				lib.missing = append(lib.missing, inst.Master)
+			}
+		}
+	}
+}
+
+// ResolveLibraries returns the library files declaring the masters instantiated
+// in files but declared in none of them, like the simulators do: the -v files
+// declaring them, or the files of the -y directories named like them with one
+// of the +libext+ extensions. The units instantiated by the library files are
+// resolved too.
+func (fl *FileList) ResolveLibraries(files []string) []string {
+	lib := &library{declared: map[string]bool{}}
+	for _, file := range files {
+		lib.add(file)
+	}
+
+	// the units of the -v files, read once
+	libUnits := map[string]string{}
+	for _, file := range fl.LibFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"file":  file,
+				"error": err,
+			}).Warn("Error reading library file")
+			continue
+		}
+		f, _ := vparse.Parse(string(data))
+		for _, u := range f.Units {
+			if _, ok := libUnits[u.Name]; !ok {
+				libUnits[u.Name] = file
+			}
+		}
+	}
+
+	exts := fl.LibExts
+	if len(exts) == 0 {
+		exts = []string{""}
+	}
+	var pulled []string
+	added := map[string]bool{}
+	for len(lib.missing) > 0 {
+		master := lib.missing[0]
+		lib.missing = lib.missing[1:]
+		if lib.declared[master] {
+			continue
+		}
+		file := libUnits[master]
+		for _, dir := range fl.LibDirs {
+			for _, ext := range exts {
+				if path := filepath.Join(dir, master+ext); file == "" && isFile(path) {
+					file = path
+				}
+			}
+		}
+		// marked as declared either way, so it is looked up once
+		lib.declared[master] = true
+		if file == "" || added[file] {
+			continue
+		}
+		added[file] = true
+		pulled = append(pulled, file)
+		lib.add(file)
+	}
+
+	if len(pulled) > 0 {
+		log.WithFields(log.Fields{
+			"files": pulled,
+		}).Info("Pulled in library files")
+	}
+	return pulled
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
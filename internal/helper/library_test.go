@@ -0,0 +1,47 @@
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveLibraries(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"top.v":             "module top; core u_core (); and g1 (a, b, c); endmodule\n",
+		"core.v":            "module core; BUFX2 U1 (); INVX1 U2 (); dff U3 (); endmodule\n",
+		"cells/BUFX2.v":     "module BUFX2; endmodule\n",
+		"cells/INVX1.sv":    "module INVX1; nand_cell U0 (); endmodule\n",
+		"cells/nand_cell.v": "module nand_cell; endmodule\n",
+		"cells/unused.v":    "module unused; endmodule\n",
+		"seq.v":             "module dff; endmodule\nmodule latch; endmodule\n",
+	}
+	for name, text := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fl := &FileList{
+		Files:    []string{filepath.Join(dir, "top.v")},
+		LibFiles: []string{filepath.Join(dir, "seq.v")},
+		LibDirs:  []string{dir, filepath.Join(dir, "cells")},
+		LibExts:  []string{".v", ".sv"},
+	}
+	got := fl.ResolveLibraries(fl.Files)
+	expect := []string{
+		filepath.Join(dir, "core.v"),
+		filepath.Join(dir, "cells/BUFX2.v"),
+		filepath.Join(dir, "cells/INVX1.sv"),
+		filepath.Join(dir, "seq.v"),
+		filepath.Join(dir, "cells/nand_cell.v"),
+	}
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("Expected %v, got %v", expect, got)
+	}
+}
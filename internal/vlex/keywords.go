@@ -0,0 +1,51 @@
+package vlex
+
+// keywords holds the reserved words of Verilog-2005 and the commonly used
+// SystemVerilog additions. The library map words (cell, design, instance,
+// ...) are left out since they are only reserved inside config blocks and
+// often show up as net names in netlists.
+var keywords = map[string]bool{}
+
+func init() {
+	for _, kw := range []string{
+		// Verilog-2005
+		"always", "and", "assign", "automatic", "begin", "buf", "bufif0", "bufif1",
+		"case", "casex", "casez", "cmos", "config", "deassign", "default",
+		"defparam", "disable", "edge", "else", "end", "endcase", "endconfig",
+		"endfunction", "endgenerate", "endmodule", "endprimitive", "endspecify",
+		"endtable", "endtask", "event", "for", "force", "forever", "fork", "function",
+		"generate", "genvar", "highz0", "highz1", "if", "ifnone", "initial", "inout",
+		"input", "integer", "join", "large", "localparam", "macromodule", "medium",
+		"module", "nand", "negedge", "nmos", "nor", "noshowcancelled", "not", "notif0",
+		"notif1", "or", "output",
+		"parameter", "pmos", "posedge", "primitive", "pull0", "pull1", "pulldown",
+		"pullup", "pulsestyle_onevent", "pulsestyle_ondetect", "rcmos", "real",
+		"realtime", "reg", "release", "repeat", "rnmos", "rpmos", "rtran", "rtranif0",
+		"rtranif1", "scalared", "showcancelled", "signed", "small", "specify",
+		"specparam", "strong0", "strong1", "supply0", "supply1", "table", "task",
+		"time", "tran", "tranif0", "tranif1", "tri", "tri0", "tri1", "triand",
+		"trior", "trireg", "unsigned", "uwire", "vectored", "wait", "wand",
+		"weak0", "weak1", "while", "wire", "wor", "xnor", "xor",
+		// SystemVerilog
+		"always_comb", "always_ff", "always_latch", "assert", "assume", "bit",
+		"break", "byte", "chandle", "checker", "class", "clocking", "const",
+		"constraint", "context", "continue", "cover", "covergroup", "do",
+		"endchecker", "endclass", "endclocking", "endgroup", "endinterface",
+		"endpackage", "endprogram", "endproperty", "endsequence", "enum", "export",
+		"extends", "extern", "final", "foreach", "forkjoin", "iff", "import",
+		"inside", "int", "interface", "join_any", "join_none", "let", "local",
+		"logic", "longint", "modport", "new", "null", "package", "packed",
+		"priority", "program", "property", "protected", "pure", "rand", "randc",
+		"ref", "return", "sequence", "shortint", "shortreal", "static", "string",
+		"struct", "super", "this", "timeprecision", "timeunit", "type", "typedef",
+		"union", "unique", "unique0", "var", "virtual", "void", "wait_order",
+		"wildcard", "with",
+	} {
+		keywords[kw] = true
+	}
+}
+
+// IsKeyword reports whether s is a reserved word.
+func IsKeyword(s string) bool {
+	return keywords[s]
+}
@@ -0,0 +1,352 @@
+// Package vlex splits Verilog/SystemVerilog source into tokens.
+//
+// The lexer is lossless: concatenating the text of all tokens returned by Lex
+// gives back the original source, so tokens can be used both for searching and
+// for rewriting the text in place.
+package vlex
+
+import (
+	"strings"
+)
+
+// Kind is the category of a token.
+type Kind int
+
+const (
+	Illegal Kind = iota
+	Whitespace
+	Comment
+	Ident
+	EscapedIdent
+	SystemIdent
+	Keyword
+	String
+	Number
+	Attribute
+	Directive
+	Operator
+)
+
+var kindNames = [...]string{
+	Illegal:      "illegal",
+	Whitespace:   "whitespace",
+	Comment:      "comment",
+	Ident:        "identifier",
+	EscapedIdent: "escaped identifier",
+	SystemIdent:  "system identifier",
+	Keyword:      "keyword",
+	String:       "string",
+	Number:       "number",
+	Attribute:    "attribute",
+	Directive:    "directive",
+	Operator:     "operator",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "unknown"
+}
+
+// Token is one lexical element of the source.
+type Token struct {
+	Kind Kind
+	Text string
+	// Pos is the byte offset of the first character in the source.
+	Pos int
+}
+
+// End returns the byte offset just after the token.
+func (t Token) End() int {
+	return t.Pos + len(t.Text)
+}
+
+// IsTrivia reports whether the token is whitespace or a comment.
+func (t Token) IsTrivia() bool {
+	return t.Kind == Whitespace || t.Kind == Comment
+}
+
+// IsIdent reports whether the token is a plain or escaped identifier.
+func (t Token) IsIdent() bool {
+	return t.Kind == Ident || t.Kind == EscapedIdent
+}
+
+// Is reports whether the token is the keyword or operator s.
+func (t Token) Is(s string) bool {
+	return (t.Kind == Keyword || t.Kind == Operator) && t.Text == s
+}
+
+// Name returns the identifier name of the token. The leading backslash of an
+// escaped identifier is dropped, so `\foo` and `foo` have the same name.
+func (t Token) Name() string {
+	if t.Kind == EscapedIdent {
+		return t.Text[1:]
+	}
+	return t.Text
+}
+
+// operators lists the multi-character operators, longest first.
+var operators = []string{
+	"<<<=", ">>>=",
+	"===", "!==", "==?", "!=?", "<<<", ">>>", "<<=", ">>=", "->>", "<->", "|->", "|=>",
+	"==", "!=", "<=", ">=", "&&", "||", "**", "<<", ">>", "->", "::", "+:", "-:",
+	"++", "--", "+=", "-=", "*=", "/=", "%=", "&=", "|=", "^=", "~&", "~|", "~^", "^~",
+	"'{", "##", "@@", ".*", ":=", ":/",
+}
+
+// Lex splits src into tokens. It never fails; bytes that do not start any
+// token are returned as Illegal tokens.
+func Lex(src string) []Token {
+	var toks []Token
+	i := 0
+	for i < len(src) {
+		kind, n := scan(src, i)
+		toks = append(toks, Token{Kind: kind, Text: src[i : i+n], Pos: i})
+		i += n
+	}
+	return toks
+}
+
+// Significant returns the tokens which are neither whitespace nor comments.
+func Significant(toks []Token) []Token {
+	res := make([]Token, 0, len(toks))
+	for _, t := range toks {
+		if !t.IsTrivia() {
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// scan returns the kind and length of the token starting at src[i].
+func scan(src string, i int) (Kind, int) {
+	c := src[i]
+	switch {
+	case isSpace(c):
+		j := i
+		for j < len(src) && isSpace(src[j]) {
+			j++
+		}
+		return Whitespace, j - i
+	case c == '/' && i+1 < len(src) && src[i+1] == '/':
+		j := strings.IndexByte(src[i:], '\n')
+		if j < 0 {
+			return Comment, len(src) - i
+		}
+		return Comment, j
+	case c == '/' && i+1 < len(src) && src[i+1] == '*':
+		j := strings.Index(src[i+2:], "*/")
+		if j < 0 {
+			return Comment, len(src) - i
+		}
+		return Comment, j + 4
+	case c == '(' && i+1 < len(src) && src[i+1] == '*':
+		if n := scanAttribute(src, i); n > 0 {
+			return Attribute, n
+		}
+		return Operator, 1
+	case isIdentStart(c):
+		j := i + 1
+		for j < len(src) && isIdentChar(src[j]) {
+			j++
+		}
+		if IsKeyword(src[i:j]) {
+			return Keyword, j - i
+		}
+		return Ident, j - i
+	case c == '\\':
+		j := i + 1
+		for j < len(src) && !isSpace(src[j]) {
+			j++
+		}
+		if j == i+1 {
+			return Illegal, 1
+		}
+		return EscapedIdent, j - i
+	case c == '$':
+		j := i + 1
+		for j < len(src) && isIdentChar(src[j]) {
+			j++
+		}
+		if j == i+1 {
+			return Operator, 1
+		}
+		return SystemIdent, j - i
+	case c == '`':
+		j := i + 1
+		for j < len(src) && isIdentChar(src[j]) {
+			j++
+		}
+		if j == i+1 || !isIdentStart(src[i+1]) {
+			return Operator, 1
+		}
+		return Directive, j - i
+	case c == '"':
+		return String, scanString(src, i)
+	case isDigit(c):
+		return Number, scanNumber(src, i)
+	case c == '\'':
+		if n := scanBased(src, i); n > 0 {
+			return Number, n
+		}
+		if i+1 < len(src) && src[i+1] == '{' {
+			return Operator, 2
+		}
+		return Operator, 1
+	}
+	for _, op := range operators {
+		if strings.HasPrefix(src[i:], op) {
+			return Operator, len(op)
+		}
+	}
+	if c < 0x80 && c > ' ' {
+		return Operator, 1
+	}
+	return Illegal, 1
+}
+
+// scanAttribute returns the length of the attribute instance `(* ... *)`
+// starting at src[i], or 0 if src[i] starts `(*)` as in `@(*)`.
+func scanAttribute(src string, i int) int {
+	j := i + 2
+	for j < len(src) && isSpace(src[j]) {
+		j++
+	}
+	if j >= len(src) || src[j] == ')' {
+		return 0
+	}
+	for j < len(src) {
+		switch {
+		case src[j] == '"':
+			j += scanString(src, j)
+		case src[j] == '*' && j+1 < len(src) && src[j+1] == ')':
+			return j + 2 - i
+		default:
+			j++
+		}
+	}
+	return len(src) - i
+}
+
+// scanString returns the length of the string literal starting at src[i].
+func scanString(src string, i int) int {
+	j := i + 1
+	for j < len(src) {
+		switch src[j] {
+		case '\\':
+			j += 2
+		case '"':
+			return j + 1 - i
+		case '\n':
+			return j - i
+		default:
+			j++
+		}
+	}
+	return len(src) - i
+}
+
+// scanNumber returns the length of the number starting with a digit at
+// src[i]. It covers decimal, real, time and sized based literals.
+func scanNumber(src string, i int) int {
+	j := i
+	for j < len(src) && (isDigit(src[j]) || src[j] == '_') {
+		j++
+	}
+	if n := scanBased(src, j); n > 0 {
+		return j + n - i
+	}
+	if j+1 < len(src) && src[j] == '.' && isDigit(src[j+1]) {
+		j++
+		for j < len(src) && (isDigit(src[j]) || src[j] == '_') {
+			j++
+		}
+	}
+	if j < len(src) && (src[j] == 'e' || src[j] == 'E') {
+		k := j + 1
+		if k < len(src) && (src[k] == '+' || src[k] == '-') {
+			k++
+		}
+		if k < len(src) && isDigit(src[k]) {
+			j = k
+			for j < len(src) && (isDigit(src[j]) || src[j] == '_') {
+				j++
+			}
+		}
+	}
+	for _, unit := range []string{"step", "ms", "us", "ns", "ps", "fs", "s"} {
+		if strings.HasPrefix(src[j:], unit) && (j+len(unit) == len(src) || !isIdentChar(src[j+len(unit)])) {
+			return j + len(unit) - i
+		}
+	}
+	return j - i
+}
+
+// scanBased returns the length of the based literal `'[s]<base><digits>` or
+// the unbased unsized literal `'0`, `'1`, `'x`, `'z` starting at src[i], or 0.
+func scanBased(src string, i int) int {
+	if i >= len(src) || src[i] != '\'' {
+		return 0
+	}
+	j := i + 1
+	if j < len(src) && (src[j] == 's' || src[j] == 'S') {
+		j++
+	}
+	if j < len(src) && strings.IndexByte("bBoOdDhH", src[j]) >= 0 {
+		j++
+		for j < len(src) && (src[j] == ' ' || src[j] == '\t') {
+			j++
+		}
+		k := j
+		for k < len(src) && (isHexDigit(src[k]) || strings.IndexByte("xXzZ?_", src[k]) >= 0) {
+			k++
+		}
+		if k == j {
+			return 0
+		}
+		return k - i
+	}
+	if j == i+1 && j < len(src) && strings.IndexByte("01xXzZ", src[j]) >= 0 && (j+1 == len(src) || !isIdentChar(src[j+1])) {
+		return 2
+	}
+	return 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isIdentStart(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
+
+// Blank returns src with the comments, string literals and attributes
+// replaced by spaces. Newlines are kept, so offsets and line numbers in the
+// result are the same as in src.
+func Blank(src string) string {
+	b := []byte(src)
+	for _, t := range Lex(src) {
+		if t.Kind != Comment && t.Kind != String && t.Kind != Attribute {
+			continue
+		}
+		for i := t.Pos; i < t.End(); i++ {
+			if b[i] != '\n' {
+				b[i] = ' '
+			}
+		}
+	}
+	return string(b)
+}
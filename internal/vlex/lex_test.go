@@ -0,0 +1,70 @@
+package vlex
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLexLossless(t *testing.T) {
+	src := "`timescale 1ns/1ps\n" +
+		"(* keep = \"yes\" *) module \\bus[0] (input [7:0] a, output reg b); // c\n" +
+		"  always @(*) b = a == 8'hFF ? 1'b1 : 'x; /* block\n */\n" +
+		"  initial $display(\"a \\\" b\", 1.5e-3, 10ns);\n" +
+		"endmodule\n"
+	var b strings.Builder
+	for _, tok := range Lex(src) {
+		if tok.Kind == Illegal {
+			t.Errorf("unexpected illegal token %q at %d", tok.Text, tok.Pos)
+		}
+		b.WriteString(tok.Text)
+	}
+	if b.String() != src {
+		t.Errorf("Expected lossless lexing, got\n%s", b.String())
+	}
+}
+
+func TestLexKinds(t *testing.T) {
+	src := "`define (* a = \"*)\" *) @(*) \\esc$id  $finish module mod_1 \"s // t\" 4'b10xz 'z 3.14 <= ."
+	expect := []struct {
+		kind Kind
+		text string
+	}{
+		{Directive, "`define"},
+		{Attribute, "(* a = \"*)\" *)"},
+		{Operator, "@"},
+		{Operator, "("},
+		{Operator, "*"},
+		{Operator, ")"},
+		{EscapedIdent, "\\esc$id"},
+		{SystemIdent, "$finish"},
+		{Keyword, "module"},
+		{Ident, "mod_1"},
+		{String, "\"s // t\""},
+		{Number, "4'b10xz"},
+		{Number, "'z"},
+		{Number, "3.14"},
+		{Operator, "<="},
+		{Operator, "."},
+	}
+
+	toks := Significant(Lex(src))
+	if len(toks) != len(expect) {
+		t.Fatalf("Expected %d tokens, but got %d: %v", len(expect), len(toks), toks)
+	}
+	for i, e := range expect {
+		if toks[i].Kind != e.kind || toks[i].Text != e.text {
+			t.Errorf("token %d: expected %s %q, but got %s %q", i, e.kind, e.text, toks[i].Kind, toks[i].Text)
+		}
+	}
+	if toks[6].Name() != "esc$id" {
+		t.Errorf("Expected escaped name esc$id, but got %s", toks[6].Name())
+	}
+}
+
+func TestBlank(t *testing.T) {
+	src := "a /* b\nc */ \"d\" (* e *) f // g\nh"
+	expect := "a     \n                 f     \nh"
+	if got := Blank(src); got != expect {
+		t.Errorf("Expected %q, but got %q", expect, got)
+	}
+}
@@ -0,0 +1,236 @@
+// Package vparse parses the structure of Verilog/SystemVerilog design units.
+//
+// The parser does not elaborate anything. It finds the module, macromodule,
+// primitive, interface, program, package and config declarations and records
+// their name, parameters, ports, declarations and instances together with the
+// source spans of every piece, so the callers can edit the text in place.
+// Procedural code, functions, specify blocks and the like are skipped.
+package vparse
+
+import (
+	"strings"
+)
+
+// Span is the byte range [Start, End) of a piece of the source.
+type Span struct {
+	Start int
+	End   int
+}
+
+// Empty reports whether the span covers no text, which is also the case for
+// the zero Span of a missing piece.
+func (s Span) Empty() bool {
+	return s.End <= s.Start
+}
+
+// Text returns the source covered by the span.
+func (s Span) Text(src string) string {
+	if s.Empty() {
+		return ""
+	}
+	return src[s.Start:s.End]
+}
+
+// File holds the design units of one source text.
+type File struct {
+	Units []*Unit
+}
+
+// Unit is one design unit declaration.
+type Unit struct {
+	// Kind is the declaration keyword: module, macromodule, primitive,
+	// interface, program, package or config.
+	Kind string
+	Name string
+	// Span goes from the declaration keyword to the end keyword, including
+	// the optional end label.
+	Span     Span
+	NameSpan Span
+	// Header goes from the declaration keyword to the semicolon ending the
+	// header, Body from there to the end keyword.
+	Header Span
+	Body   Span
+	// EndSpan is the end keyword and its optional label.
+	EndSpan Span
+	// ParamList is the "#( ... )" parameter port list and PortList the
+	// "( ... )" port list of the header. Both are empty when missing.
+	ParamList Span
+	PortList  Span
+	// ANSI is set when the port list declares the ports itself.
+	ANSI      bool
+	Params    []*Param
+	Ports     []*Port
+	Decls     []*Decl
+	Instances []*Instance
+}
+
+// Param is a parameter or localparam of a unit.
+type Param struct {
+	Name string
+	// Kind is parameter or localparam.
+	Kind string
+	// Type is the type and packed range given before the name, if any.
+	Type  string
+	Value string
+	// InHeader is set for the parameters of the parameter port list.
+	InHeader bool
+	// Span covers the declarator, from the name to the end of the value.
+	// For the header parameters declaring their own kind or type, it starts
+	// at the keyword instead.
+	Span      Span
+	NameSpan  Span
+	ValueSpan Span
+	// Decl is the body declaration holding the parameter, nil in the header.
+	Decl *Decl
+}
+
+// Port is a port of a unit.
+type Port struct {
+	Name string
+	// Dir is input, output, inout or ref, and empty when not declared.
+	Dir string
+	// Type is the net or variable type, e.g. wire, reg or logic.
+	Type   string
+	Signed bool
+	// Range is the packed range, e.g. "[7:0]".
+	Range string
+	// Span is the entry of the header port list. For ANSI ports declaring
+	// their own direction or type it starts at the first keyword, otherwise
+	// at the name.
+	Span     Span
+	NameSpan Span
+	// Inherited is set for ANSI ports taking the direction and type of the
+	// previous port.
+	Inherited bool
+	// Decl is the body declaration of a non-ANSI port.
+	Decl *Decl
+}
+
+// Decl is a declaration statement of the unit body.
+type Decl struct {
+	// Kind is the first keyword of the declaration, e.g. input, wire or
+	// parameter, or the name of the user defined type.
+	Kind string
+	// Type is the text between the kind and the first name, without the
+	// packed range.
+	Type   string
+	Signed bool
+	Range  string
+	Vars   []*Var
+	// Span is the whole statement including the semicolon.
+	Span Span
+}
+
+// Var is one declarator of a declaration statement.
+type Var struct {
+	Name     string
+	NameSpan Span
+	// Span goes from the name to the end of the unpacked dimensions and the
+	// initial value.
+	Span Span
+}
+
+// Instance is one instance of a module, interface, primitive or gate.
+type Instance struct {
+	Master     string
+	MasterSpan Span
+	// Name is empty for unnamed gate instances.
+	Name     string
+	NameSpan Span
+	// Range is the instance array range, e.g. "[3:0]".
+	Range string
+	// ParamList is the "#( ... )" parameter value assignment and Params its
+	// items. They are shared by all the instances of the statement.
+	ParamList Span
+	Params    []*Conn
+	// ConnList is the "( ... )" port connection list.
+	ConnList Span
+	Conns    []*Conn
+	// Span goes from the instance name to the end of the connection list.
+	Span Span
+	// Stmt is the whole instantiation statement including the semicolon.
+	// It is shared by all the instances of the statement.
+	Stmt Span
+}
+
+// Conn is one item of a port connection or parameter value list.
+type Conn struct {
+	// Name is the port or parameter name of a named connection, "*" for
+	// ".*", and empty for positional connections.
+	Name string
+	Expr string
+	// Span is the whole item, ExprSpan the expression alone. ExprSpan is
+	// empty for ".name", ".name()" and empty positional items.
+	Span     Span
+	ExprSpan Span
+	// Implicit is set for ".name" and ".*".
+	Implicit bool
+}
+
+// Named reports whether the connection is by name.
+func (c *Conn) Named() bool {
+	return c.Name != ""
+}
+
+// Unit returns the first unit called name, or nil.
+func (f *File) Unit(name string) *Unit {
+	for _, u := range f.Units {
+		if u.Name == name {
+			return u
+		}
+	}
+	return nil
+}
+
+// Port returns the port called name, or nil.
+func (u *Unit) Port(name string) *Port {
+	for _, p := range u.Ports {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Param returns the parameter called name, or nil.
+func (u *Unit) Param(name string) *Param {
+	for _, p := range u.Params {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// Instance returns the instance called name, or nil.
+func (u *Unit) Instance(name string) *Instance {
+	for _, inst := range u.Instances {
+		if inst.Name == name {
+			return inst
+		}
+	}
+	return nil
+}
+
+// IsModule reports whether the unit is a module or a macromodule.
+func (u *Unit) IsModule() bool {
+	return u.Kind == "module" || u.Kind == "macromodule"
+}
+
+// DeclText returns the declaration text of the port as it would appear in an
+// ANSI port list, e.g. "input wire [7:0] a".
+func (p *Port) DeclText() string {
+	var fields []string
+	for _, f := range []string{p.Dir, p.Type} {
+		if f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if p.Signed {
+		fields = append(fields, "signed")
+	}
+	if p.Range != "" {
+		fields = append(fields, p.Range)
+	}
+	return strings.Join(append(fields, p.Name), " ")
+}
@@ -0,0 +1,905 @@
+package vparse
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zhuzhzh/vmod/internal/vlex"
+)
+
+// unitEnds maps the keywords declaring a design unit to their end keyword.
+var unitEnds = map[string]string{
+	"module":      "endmodule",
+	"macromodule": "endmodule",
+	"primitive":   "endprimitive",
+	"interface":   "endinterface",
+	"program":     "endprogram",
+	"package":     "endpackage",
+	"config":      "endconfig",
+}
+
+// blockEnds maps the keywords of the body constructs skipped as a whole to
+// their end keyword.
+var blockEnds = map[string]string{
+	"function":   "endfunction",
+	"task":       "endtask",
+	"specify":    "endspecify",
+	"table":      "endtable",
+	"class":      "endclass",
+	"covergroup": "endgroup",
+	"property":   "endproperty",
+	"sequence":   "endsequence",
+	"clocking":   "endclocking",
+	"checker":    "endchecker",
+}
+
+var directions = map[string]bool{
+	"input":  true,
+	"output": true,
+	"inout":  true,
+	"ref":    true,
+}
+
+// dataTypes holds the keywords starting a net or variable declaration.
+var dataTypes = map[string]bool{
+	"wire": true, "tri": true, "tri0": true, "tri1": true, "triand": true,
+	"trior": true, "trireg": true, "wand": true, "wor": true, "uwire": true,
+	"supply0": true, "supply1": true, "reg": true, "logic": true, "bit": true,
+	"byte": true, "shortint": true, "int": true, "longint": true,
+	"integer": true, "time": true, "real": true, "shortreal": true,
+	"realtime": true, "string": true, "chandle": true, "event": true,
+	"genvar": true, "var": true, "enum": true, "struct": true, "union": true,
+	"const": true, "static": true, "automatic": true,
+}
+
+// gates holds the built-in gate and switch primitives.
+var gates = map[string]bool{
+	"and": true, "nand": true, "or": true, "nor": true, "xor": true,
+	"xnor": true, "buf": true, "not": true, "bufif0": true, "bufif1": true,
+	"notif0": true, "notif1": true, "nmos": true, "pmos": true, "rnmos": true,
+	"rpmos": true, "cmos": true, "rcmos": true, "tran": true, "rtran": true,
+	"tranif0": true, "tranif1": true, "rtranif0": true, "rtranif1": true,
+	"pullup": true, "pulldown": true,
+}
+
+// procedures holds the keywords followed by one procedural statement.
+var procedures = map[string]bool{
+	"always": true, "always_comb": true, "always_ff": true,
+	"always_latch": true, "initial": true, "final": true,
+}
+
+type parser struct {
+	src  string
+	toks []vlex.Token
+	// nl[i] is set when a line break precedes toks[i].
+	nl  []bool
+	pos int
+}
+
+// Parse parses the design units of src. It is tolerant: the constructs it
+// does not know are skipped, and the units which are parsed before an error
+// are still returned along with it.
+func Parse(src string) (*File, error) {
+	p := &parser{src: src}
+	brk := false
+	for _, t := range vlex.Lex(src) {
+		if t.IsTrivia() {
+			brk = brk || strings.Contains(t.Text, "\n")
+			continue
+		}
+		p.toks = append(p.toks, t)
+		p.nl = append(p.nl, brk)
+		brk = false
+	}
+
+	f := &File{}
+	for !p.eof() {
+		t := p.tok()
+		switch {
+		case t.Kind == vlex.Keyword && unitEnds[t.Text] != "":
+			u, err := p.unit()
+			if err != nil {
+				return f, err
+			}
+			if u != nil {
+				f.Units = append(f.Units, u)
+			}
+		case t.Kind == vlex.Directive:
+			p.skipDirective()
+		default:
+			p.pos++
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.toks)
+}
+
+// tok returns the current token, or an Illegal token at the end of the
+// source.
+func (p *parser) tok() vlex.Token {
+	return p.peek(0)
+}
+
+func (p *parser) peek(k int) vlex.Token {
+	if p.pos+k >= len(p.toks) {
+		return vlex.Token{Kind: vlex.Illegal, Pos: len(p.src)}
+	}
+	return p.toks[p.pos+k]
+}
+
+// is reports whether the current token is the keyword or operator s.
+func (p *parser) is(s string) bool {
+	return p.tok().Is(s)
+}
+
+// end returns the offset after the previous token.
+func (p *parser) end() int {
+	switch {
+	case p.pos == 0:
+		return 0
+	case p.pos > len(p.toks):
+		return len(p.src)
+	}
+	return p.toks[p.pos-1].End()
+}
+
+// span returns the span of the tokens [a, b).
+func (p *parser) span(a, b int) Span {
+	if b <= a {
+		if a < len(p.toks) {
+			return Span{p.toks[a].Pos, p.toks[a].Pos}
+		}
+		return Span{len(p.src), len(p.src)}
+	}
+	return Span{p.toks[a].Pos, p.toks[b-1].End()}
+}
+
+func (p *parser) text(a, b int) string {
+	return p.span(a, b).Text(p.src)
+}
+
+func isOpen(t vlex.Token) bool {
+	return t.Is("(") || t.Is("[") || t.Is("{") || t.Is("'{")
+}
+
+func isClose(t vlex.Token) bool {
+	return t.Is(")") || t.Is("]") || t.Is("}")
+}
+
+// skipBalanced skips the bracketed group starting at the current token.
+func (p *parser) skipBalanced() {
+	depth := 0
+	for !p.eof() {
+		t := p.tok()
+		p.pos++
+		if isOpen(t) {
+			depth++
+		} else if isClose(t) {
+			if depth--; depth <= 0 {
+				return
+			}
+		}
+	}
+}
+
+// skipDirective skips a compiler directive with the rest of its line.
+func (p *parser) skipDirective() {
+	p.pos++
+	for !p.eof() && !(p.nl[p.pos] && !(p.toks[p.pos-1].Kind == vlex.Illegal && p.toks[p.pos-1].Text == "\\")) {
+		p.pos++
+	}
+}
+
+// skipStatement skips to the semicolon ending the current statement, which
+// is consumed too. It stops before the end keyword stop, if given.
+func (p *parser) skipStatement(stop string) {
+	depth := 0
+	for !p.eof() {
+		t := p.tok()
+		switch {
+		case depth == 0 && stop != "" && t.Kind == vlex.Keyword && t.Text == stop:
+			return
+		case isOpen(t):
+			depth++
+		case isClose(t):
+			depth--
+		case depth <= 0 && t.Is(";"):
+			p.pos++
+			return
+		}
+		p.pos++
+	}
+}
+
+// skipTo skips past the keyword end, taking nested blocks of the same kind
+// into account. The current token is the opening keyword.
+func (p *parser) skipTo(end string) {
+	open := p.tok().Text
+	depth := 0
+	for !p.eof() {
+		t := p.tok()
+		p.pos++
+		if t.Kind != vlex.Keyword {
+			continue
+		}
+		if t.Text == open && unitEnds[open] == end {
+			depth++
+		} else if t.Text == open && blockEnds[open] == end && !p.isPrototype(p.pos-1) {
+			depth++
+		} else if t.Text == end {
+			if depth--; depth <= 0 {
+				p.skipLabel()
+				return
+			}
+		}
+	}
+}
+
+// isPrototype reports whether the tokens before toks[i] make it part of an
+// import or extern prototype like `import "DPI-C" function ...`, which has
+// no end keyword.
+func (p *parser) isPrototype(i int) bool {
+	for k := i - 1; k >= 0; k-- {
+		t := p.toks[k]
+		if t.Is(";") || t.Kind == vlex.Keyword && (t.Text == "import" || t.Text == "extern" || t.Text == "export") {
+			return !t.Is(";")
+		}
+		if t.Kind != vlex.String && t.Kind != vlex.Keyword && t.Kind != vlex.Attribute {
+			return false
+		}
+	}
+	return false
+}
+
+// skipLabel skips the ": label" following an end keyword.
+func (p *parser) skipLabel() {
+	if p.is(":") && p.peek(1).IsIdent() {
+		p.pos += 2
+	}
+}
+
+// list splits the parenthesized list starting at the current token into its
+// comma separated items, given as token index ranges. It returns the span of
+// the list including the parentheses and moves past it.
+func (p *parser) list() ([][2]int, Span) {
+	start := p.pos
+	var items [][2]int
+	p.pos++
+	a, depth := p.pos, 0
+	for !p.eof() {
+		t := p.tok()
+		switch {
+		case isOpen(t):
+			depth++
+		case isClose(t) && depth > 0:
+			depth--
+		case isClose(t):
+			if p.pos > a || len(items) > 0 {
+				items = append(items, [2]int{a, p.pos})
+			}
+			p.pos++
+			return items, p.span(start, p.pos)
+		case depth == 0 && t.Is(","):
+			items = append(items, [2]int{a, p.pos})
+			a = p.pos + 1
+		}
+		p.pos++
+	}
+	return items, p.span(start, p.pos)
+}
+
+// declarator finds the name of the declaration item [a, b): the last
+// identifier outside brackets before the "=" of the initial value. It
+// returns the index of the name and of the "=", which is b when missing.
+func (p *parser) declarator(a, b int) (name int, eq int) {
+	name, eq = -1, b
+	depth := 0
+	for k := a; k < b; k++ {
+		t := p.toks[k]
+		switch {
+		case isOpen(t):
+			depth++
+		case isClose(t):
+			depth--
+		case depth == 0 && t.Is("="):
+			return name, k
+		case depth == 0 && t.IsIdent():
+			name = k
+		}
+	}
+	return name, eq
+}
+
+// typeOf splits the tokens [a, b) preceding a declared name into the type,
+// the signing and the packed range.
+func (p *parser) typeOf(a, b int) (typ string, signed bool, rng string) {
+	var words []string
+	for k := a; k < b; k++ {
+		t := p.toks[k]
+		switch {
+		case t.Kind == vlex.Attribute:
+		case t.Is("signed"):
+			signed = true
+		case t.Is("unsigned"):
+		case t.Is("["):
+			j := k
+			for depth := 0; j < b; j++ {
+				if isOpen(p.toks[j]) {
+					depth++
+				} else if isClose(p.toks[j]) {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+			rng += p.text(k, j+1)
+			k = j
+		case t.Is(".") || t.Is("::") || (k > a && (p.toks[k-1].Is(".") || p.toks[k-1].Is("::"))):
+			if len(words) == 0 {
+				words = append(words, "")
+			}
+			words[len(words)-1] += t.Text
+		default:
+			words = append(words, t.Text)
+		}
+	}
+	return strings.Join(words, " "), signed, rng
+}
+
+// unit parses the design unit starting at the current keyword.
+func (p *parser) unit() (*Unit, error) {
+	kw := p.tok()
+	u := &Unit{Kind: kw.Text}
+	u.Span.Start = kw.Pos
+	end := unitEnds[kw.Text]
+	p.pos++
+
+	if p.is("automatic") || p.is("static") {
+		p.pos++
+	}
+	if !p.tok().IsIdent() {
+		// e.g. "virtual interface" or "interface class"
+		return nil, nil
+	}
+	u.Name = p.tok().Name()
+	u.NameSpan = p.span(p.pos, p.pos+1)
+	p.pos++
+
+	if u.Kind == "config" {
+		p.skipStatement(end)
+	} else {
+		for p.is("import") {
+			p.skipStatement(end)
+		}
+		if p.is("#") && p.peek(1).Is("(") {
+			hash := p.tok().Pos
+			p.pos++
+			p.paramPorts(u)
+			u.ParamList.Start = hash
+		}
+		if p.is("(") {
+			p.ports(u)
+		}
+		p.skipStatement(end)
+	}
+	u.Header = Span{u.Span.Start, p.end()}
+
+	if err := p.body(u, end); err != nil {
+		return nil, err
+	}
+	u.Body = Span{u.Header.End, u.EndSpan.Start}
+	u.Span.End = u.EndSpan.End
+	return u, nil
+}
+
+// paramPorts parses the parameter port list "( ... )" of the header.
+func (p *parser) paramPorts(u *Unit) {
+	items, span := p.list()
+	u.ParamList = span
+	kind, typ := "parameter", ""
+	for _, it := range items {
+		a, b := it[0], it[1]
+		for a < b && p.toks[a].Kind == vlex.Attribute {
+			a++
+		}
+		if a == b {
+			continue
+		}
+		start := a
+		if p.toks[a].Is("parameter") || p.toks[a].Is("localparam") {
+			kind = p.toks[a].Text
+			a++
+		}
+		name, eq := p.declarator(a, b)
+		if name < 0 {
+			continue
+		}
+		if name > a {
+			typ = p.text(a, name)
+		} else if a > start {
+			typ = ""
+		}
+		u.Params = append(u.Params, &Param{
+			Name:      p.toks[name].Name(),
+			Kind:      kind,
+			Type:      typ,
+			Value:     p.text(eq+1, b),
+			InHeader:  true,
+			Span:      p.span(start, b),
+			NameSpan:  p.span(name, name+1),
+			ValueSpan: p.valueSpan(eq, b),
+		})
+	}
+}
+
+// valueSpan returns the span of the value following the "=" at eq, or an
+// empty span at the end of the item when there is no value.
+func (p *parser) valueSpan(eq, b int) Span {
+	if eq >= b {
+		e := p.toks[b-1].End()
+		return Span{e, e}
+	}
+	return p.span(eq+1, b)
+}
+
+// ports parses the port list "( ... )" of the header.
+func (p *parser) ports(u *Unit) {
+	items, span := p.list()
+	u.PortList = span
+	var prev *Port
+	for i, it := range items {
+		a, b := it[0], it[1]
+		for a < b && p.toks[a].Kind == vlex.Attribute {
+			a++
+		}
+		if a == b {
+			continue
+		}
+		if i == 0 {
+			u.ANSI = !(b == a+1 && p.toks[a].IsIdent()) && !p.toks[a].Is(".") && !p.toks[a].Is("{")
+		}
+		if !u.ANSI {
+			port := &Port{Span: p.span(a, b)}
+			switch {
+			case b == a+1 && p.toks[a].IsIdent():
+				port.Name = p.toks[a].Name()
+				port.NameSpan = p.span(a, b)
+			case p.toks[a].Is(".") && a+1 < b && p.toks[a+1].IsIdent():
+				port.Name = p.toks[a+1].Name()
+				port.NameSpan = p.span(a+1, a+2)
+			}
+			u.Ports = append(u.Ports, port)
+			continue
+		}
+
+		name, _ := p.declarator(a, b)
+		if name < 0 {
+			continue
+		}
+		port := &Port{
+			Name:     p.toks[name].Name(),
+			NameSpan: p.span(name, name+1),
+			Span:     p.span(a, b),
+		}
+		k := a
+		if directions[p.toks[k].Text] {
+			port.Dir = p.toks[k].Text
+			k++
+		}
+		if k < name {
+			port.Type, port.Signed, port.Range = p.typeOf(k, name)
+		}
+		switch {
+		case name == a && prev != nil:
+			port.Inherited = true
+			port.Dir, port.Type, port.Signed, port.Range = prev.Dir, prev.Type, prev.Signed, prev.Range
+		case port.Dir == "" && prev != nil && !strings.Contains(port.Type, "."):
+			// interface.modport ports have no direction
+			port.Dir = prev.Dir
+		}
+		u.Ports = append(u.Ports, port)
+		prev = port
+	}
+}
+
+// body parses the unit items up to the end keyword.
+func (p *parser) body(u *Unit, end string) error {
+	for !p.eof() {
+		t := p.tok()
+		switch {
+		case t.Kind == vlex.Keyword && t.Text == end:
+			start := p.pos
+			p.pos++
+			p.skipLabel()
+			u.EndSpan = p.span(start, p.pos)
+			return nil
+		case t.Kind == vlex.Attribute || t.Is(";"):
+			p.pos++
+		case t.Kind == vlex.Directive:
+			p.skipDirective()
+		case t.Kind == vlex.Keyword:
+			p.keywordItem(u, end)
+		case t.Kind == vlex.Number:
+			// generate case item
+			p.caseLabel()
+		case t.IsIdent() && p.peek(1).Is(":"):
+			// generate block or case item label
+			p.pos += 2
+		case t.IsIdent():
+			if p.isInstance() {
+				p.instances(u)
+			} else {
+				p.skipStatement(end)
+			}
+		default:
+			p.skipStatement(end)
+		}
+	}
+	return fmt.Errorf("%s %s has no %s", u.Kind, u.Name, end)
+}
+
+// keywordItem parses the body item starting with a keyword.
+func (p *parser) keywordItem(u *Unit, end string) {
+	t := p.tok()
+	switch {
+	case unitEnds[t.Text] != "":
+		p.skipTo(unitEnds[t.Text])
+	case blockEnds[t.Text] != "":
+		if p.isPrototype(p.pos) {
+			p.skipStatement(end)
+			break
+		}
+		p.skipTo(blockEnds[t.Text])
+	case directions[t.Text] || dataTypes[t.Text] || t.Text == "parameter" || t.Text == "localparam":
+		p.decl(u, end)
+	case gates[t.Text]:
+		p.instances(u)
+	case procedures[t.Text]:
+		p.pos++
+		p.statement(end)
+	case t.Text == "generate" || t.Text == "endgenerate" || t.Text == "else" || t.Text == "endcase":
+		p.pos++
+	case t.Text == "begin" || t.Text == "end":
+		p.pos++
+		p.skipLabel()
+	case t.Text == "for" || t.Text == "if" || t.Text == "case" || t.Text == "casex" || t.Text == "casez":
+		// generate constructs: the items inside are parsed as usual
+		p.pos++
+		if p.is("(") {
+			p.skipBalanced()
+		}
+	case t.Text == "default" && p.peek(1).Is(":"):
+		p.pos += 2
+	default:
+		p.skipStatement(end)
+	}
+}
+
+// statement skips one procedural statement.
+func (p *parser) statement(end string) {
+	for p.tok().Kind == vlex.Attribute {
+		p.pos++
+	}
+	t := p.tok()
+	switch {
+	case p.eof() || t.Kind == vlex.Keyword && t.Text == end:
+	case t.Is("@"):
+		p.pos++
+		if p.is("(") {
+			p.skipBalanced()
+		} else if p.is("*") || p.tok().IsIdent() {
+			p.pos++
+		}
+		p.statement(end)
+	case t.Is("#") || t.Is("##"):
+		p.pos++
+		if p.is("(") {
+			p.skipBalanced()
+		} else {
+			p.pos++
+		}
+		p.statement(end)
+	case t.Is("begin") || t.Is("fork"):
+		p.pos++
+		p.skipLabel()
+		for !p.eof() && !p.is("end") && !p.is("join") && !p.is("join_any") && !p.is("join_none") && !p.is(end) {
+			p.statement(end)
+		}
+		if !p.is(end) {
+			p.pos++
+			p.skipLabel()
+		}
+	case t.Is("if"):
+		p.pos++
+		if p.is("(") {
+			p.skipBalanced()
+		}
+		p.statement(end)
+		if p.is("else") {
+			p.pos++
+			p.statement(end)
+		}
+	case t.Is("case") || t.Is("casex") || t.Is("casez") || t.Is("randcase"):
+		p.pos++
+		if p.is("(") {
+			p.skipBalanced()
+		}
+		if p.is("inside") || p.is("matches") {
+			p.pos++
+		}
+		for !p.eof() && !p.is("endcase") && !p.is(end) {
+			if p.is("default") && !p.peek(1).Is(":") {
+				p.pos++
+			} else {
+				p.caseLabel()
+			}
+			p.statement(end)
+		}
+		if p.is("endcase") {
+			p.pos++
+		}
+	case t.Is("for") || t.Is("foreach") || t.Is("while") || t.Is("repeat"):
+		p.pos++
+		if p.is("(") {
+			p.skipBalanced()
+		}
+		p.statement(end)
+	case t.Is("forever") || t.Is("unique") || t.Is("unique0") || t.Is("priority"):
+		p.pos++
+		p.statement(end)
+	case t.Is("do"):
+		p.pos++
+		p.statement(end)
+		p.skipStatement(end)
+	case t.Is("wait") && p.peek(1).Is("("):
+		p.pos++
+		p.skipBalanced()
+		p.statement(end)
+	case t.IsIdent() && p.peek(1).Is(":"):
+		p.pos += 2
+		p.statement(end)
+	default:
+		p.skipStatement(end)
+	}
+}
+
+// caseLabel skips the expressions and the colon of a case item.
+func (p *parser) caseLabel() {
+	depth := 0
+	for !p.eof() {
+		t := p.tok()
+		p.pos++
+		switch {
+		case isOpen(t):
+			depth++
+		case isClose(t):
+			depth--
+		case depth == 0 && t.Is(":"):
+			return
+		}
+	}
+}
+
+// decl parses a port, parameter, net or variable declaration.
+func (p *parser) decl(u *Unit, end string) {
+	start := p.pos
+	kind := p.tok().Text
+	p.skipStatement(end)
+	stop := p.pos
+	if stop > start && p.toks[stop-1].Is(";") {
+		stop--
+	}
+
+	d := &Decl{Kind: kind, Span: Span{p.toks[start].Pos, p.end()}}
+	var items [][2]int
+	a, depth := start+1, 0
+	for k := start + 1; k < stop; k++ {
+		t := p.toks[k]
+		if isOpen(t) {
+			depth++
+		} else if isClose(t) {
+			depth--
+		} else if depth == 0 && t.Is(",") {
+			items = append(items, [2]int{a, k})
+			a = k + 1
+		}
+	}
+	items = append(items, [2]int{a, stop})
+
+	for i, it := range items {
+		name, eq := p.declarator(it[0], it[1])
+		if name < 0 {
+			continue
+		}
+		if i == 0 {
+			d.Type, d.Signed, d.Range = p.typeOf(it[0], name)
+		}
+		v := &Var{
+			Name:     p.toks[name].Name(),
+			NameSpan: p.span(name, name+1),
+			Span:     p.span(name, it[1]),
+		}
+		d.Vars = append(d.Vars, v)
+
+		switch {
+		case kind == "parameter" || kind == "localparam":
+			u.Params = append(u.Params, &Param{
+				Name:      v.Name,
+				Kind:      kind,
+				Type:      strings.TrimSpace(d.Type + " " + d.Range),
+				Value:     p.text(eq+1, it[1]),
+				Span:      v.Span,
+				NameSpan:  v.NameSpan,
+				ValueSpan: p.valueSpan(eq, it[1]),
+				Decl:      d,
+			})
+		case directions[kind]:
+			if port := u.Port(v.Name); port != nil {
+				port.Dir, port.Decl = kind, d
+				port.Signed = port.Signed || d.Signed
+				if d.Type != "" {
+					port.Type = d.Type
+				}
+				if d.Range != "" {
+					port.Range = d.Range
+				}
+			}
+		default:
+			if port := u.Port(v.Name); port != nil && !u.ANSI && port.Type == "" {
+				port.Type = kind
+				if port.Range == "" {
+					port.Range = d.Range
+				}
+			}
+		}
+	}
+	u.Decls = append(u.Decls, d)
+}
+
+// isInstance reports whether the identifier at the current position starts
+// an instantiation: master [#(...)] name [dims] "(".
+func (p *parser) isInstance() bool {
+	k := p.pos + 1
+	if k < len(p.toks) && p.toks[k].Is("#") {
+		k++
+		if k < len(p.toks) && p.toks[k].Is("(") {
+			for depth := 0; k < len(p.toks); k++ {
+				if isOpen(p.toks[k]) {
+					depth++
+				} else if isClose(p.toks[k]) {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+		}
+		k++
+	}
+	if k >= len(p.toks) || !p.toks[k].IsIdent() {
+		return false
+	}
+	k++
+	for k < len(p.toks) && p.toks[k].Is("[") {
+		for depth := 0; k < len(p.toks); k++ {
+			if isOpen(p.toks[k]) {
+				depth++
+			} else if isClose(p.toks[k]) {
+				if depth--; depth == 0 {
+					break
+				}
+			}
+		}
+		k++
+	}
+	return k < len(p.toks) && p.toks[k].Is("(")
+}
+
+// instances parses an instantiation statement.
+func (p *parser) instances(u *Unit) {
+	start := p.pos
+	master := p.tok()
+	p.pos++
+	var (
+		params    []*Conn
+		paramList Span
+	)
+	if p.is("(") && gates[master.Text] && p.isStrength() {
+		p.skipBalanced()
+	}
+	if p.is("#") {
+		hash := p.tok().Pos
+		p.pos++
+		if p.is("(") {
+			var items [][2]int
+			items, paramList = p.list()
+			paramList.Start = hash
+			params = p.conns(items)
+		} else if !p.eof() {
+			// a delay like #1
+			p.pos++
+		}
+	}
+
+	var insts []*Instance
+	for !p.eof() {
+		inst := &Instance{
+			Master:     master.Name(),
+			MasterSpan: p.span(start, start+1),
+			ParamList:  paramList,
+			Params:     params,
+		}
+		first := p.pos
+		if p.tok().IsIdent() {
+			inst.Name = p.tok().Name()
+			inst.NameSpan = p.span(p.pos, p.pos+1)
+			p.pos++
+			a := p.pos
+			for p.is("[") {
+				p.skipBalanced()
+			}
+			inst.Range = p.text(a, p.pos)
+		}
+		if !p.is("(") {
+			break
+		}
+		items, connList := p.list()
+		inst.ConnList = connList
+		inst.Conns = p.conns(items)
+		inst.Span = p.span(first, p.pos)
+		insts = append(insts, inst)
+		if !p.is(",") {
+			break
+		}
+		p.pos++
+	}
+	p.skipStatement("")
+	stmt := Span{p.toks[start].Pos, p.end()}
+	for _, inst := range insts {
+		inst.Stmt = stmt
+	}
+	u.Instances = append(u.Instances, insts...)
+}
+
+// isStrength reports whether the parenthesized group at the current position
+// is a drive strength like "(strong0, weak1)".
+func (p *parser) isStrength() bool {
+	t := p.peek(1)
+	return t.Kind == vlex.Keyword && (strings.HasPrefix(t.Text, "strong") || strings.HasPrefix(t.Text, "weak") ||
+		strings.HasPrefix(t.Text, "pull") || strings.HasPrefix(t.Text, "supply") || strings.HasPrefix(t.Text, "highz") ||
+		t.Text == "small" || t.Text == "medium" || t.Text == "large")
+}
+
+// conns turns the items of a connection or parameter value list into Conns.
+func (p *parser) conns(items [][2]int) []*Conn {
+	var res []*Conn
+	for _, it := range items {
+		a, b := it[0], it[1]
+		for a < b && p.toks[a].Kind == vlex.Attribute {
+			a++
+		}
+		c := &Conn{Span: p.span(a, b)}
+		switch {
+		case a < b && p.toks[a].Is(".*"):
+			c.Name, c.Implicit = "*", true
+		case a+1 < b && p.toks[a].Is(".") && p.toks[a+1].IsIdent():
+			c.Name = p.toks[a+1].Name()
+			if a+2 < b && p.toks[a+2].Is("(") {
+				c.ExprSpan = p.span(a+3, b-1)
+				if a+3 >= b-1 {
+					c.ExprSpan = Span{p.toks[b-1].Pos, p.toks[b-1].Pos}
+				}
+				c.Expr = c.ExprSpan.Text(p.src)
+			} else {
+				c.Implicit = true
+			}
+		default:
+			c.ExprSpan = c.Span
+			c.Expr = c.Span.Text(p.src)
+		}
+		res = append(res, c)
+	}
+	return res
+}
@@ -0,0 +1,190 @@
+package vparse
+
+import (
+	"testing"
+)
+
+const sample = "`timescale 1ns/1ps\n" + `
+// module fake(); endmodule
+module top #(parameter W = 8, localparam int D = W * 2) (
+  input  wire [W-1:0] a, b,
+  output reg  signed [D-1:0] q,
+  bus_if.mp   bus
+);
+  wire [W-1:0] n1, n2 = a;
+  parameter P = 3;
+  function automatic int f(input int x);
+    sub u_in_func (.x(x));
+    return x;
+  endfunction
+  always @(posedge a[0]) begin
+    if (b) q <= a; else begin q <= 0; end
+    case (a) 0: q <= 1; default: q <= 2; endcase
+  end
+  sub #(.W(W), .D(4)) u_sub (.a(a), .b(), .c, .*), u_sub2 (n1, , n2);
+  and #1 (n1, a[0], b[0]);
+  generate
+    for (genvar i = 0; i < 2; i++) begin : g
+      sub u_gen (.a(a[i]));
+    end
+  endgenerate
+endmodule : top
+
+primitive udp_dff (out, in, clk);
+  output out;
+  input in, clk;
+  reg out;
+  table
+    0 r : ? : 0;
+  endtable
+endprimitive
+
+macromodule old (a, b, c);
+  input [3:0] a;
+  input b;
+  output c;
+  wire c;
+endmodule
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Units) != 3 {
+		t.Fatalf("Expected 3 units, but got %d", len(f.Units))
+	}
+
+	top := f.Unit("top")
+	if top == nil || top.Kind != "module" || !top.ANSI {
+		t.Fatalf("Expected ANSI module top, but got %+v", top)
+	}
+	if got := top.Span.Text(sample); got[:10] != "module top" || got[len(got)-15:] != "endmodule : top" {
+		t.Errorf("Unexpected span of top: %q", got)
+	}
+	if got := top.EndSpan.Text(sample); got != "endmodule : top" {
+		t.Errorf("Unexpected end of top: %q", got)
+	}
+	if got := top.ParamList.Text(sample); got != "#(parameter W = 8, localparam int D = W * 2)" {
+		t.Errorf("Unexpected parameter list: %q", got)
+	}
+
+	params := []struct{ name, kind, typ, value string }{
+		{"W", "parameter", "", "8"},
+		{"D", "localparam", "int", "W * 2"},
+		{"P", "parameter", "", "3"},
+	}
+	if len(top.Params) != len(params) {
+		t.Fatalf("Expected %d parameters, but got %d", len(params), len(top.Params))
+	}
+	for i, e := range params {
+		got := top.Params[i]
+		if got.Name != e.name || got.Kind != e.kind || got.Type != e.typ || got.Value != e.value || got.ValueSpan.Text(sample) != e.value {
+			t.Errorf("parameter %d: expected %v, but got %+v", i, e, got)
+		}
+	}
+
+	ports := []struct{ name, decl string }{
+		{"a", "input wire [W-1:0] a"},
+		{"b", "input wire [W-1:0] b"},
+		{"q", "output reg signed [D-1:0] q"},
+		{"bus", "bus_if.mp bus"},
+	}
+	if len(top.Ports) != len(ports) {
+		t.Fatalf("Expected %d ports, but got %d", len(ports), len(top.Ports))
+	}
+	for i, e := range ports {
+		if got := top.Ports[i]; got.Name != e.name || got.DeclText() != e.decl {
+			t.Errorf("port %d: expected %q, but got %q", i, e.decl, got.DeclText())
+		}
+	}
+	if !top.Ports[1].Inherited || top.Ports[1].Span.Text(sample) != "b" {
+		t.Errorf("Expected port b to inherit its declaration")
+	}
+
+	var names []string
+	for _, inst := range top.Instances {
+		names = append(names, inst.Master+" "+inst.Name)
+	}
+	expect := []string{"sub u_sub", "sub u_sub2", "and ", "sub u_gen"}
+	if len(names) != len(expect) {
+		t.Fatalf("Expected instances %v, but got %v", expect, names)
+	}
+	for i := range expect {
+		if names[i] != expect[i] {
+			t.Errorf("Expected instances %v, but got %v", expect, names)
+		}
+	}
+
+	sub := top.Instance("u_sub")
+	if got := sub.Stmt.Text(sample); got[:8] != "sub #(.W" || got[len(got)-1] != ';' {
+		t.Errorf("Unexpected statement of u_sub: %q", got)
+	}
+	if len(sub.Params) != 2 || sub.Params[1].Name != "D" || sub.Params[1].Expr != "4" {
+		t.Errorf("Unexpected parameter values of u_sub: %+v", sub.Params)
+	}
+	conns := []struct {
+		name, expr string
+		implicit   bool
+	}{
+		{"a", "a", false}, {"b", "", false}, {"c", "", true}, {"*", "", true},
+	}
+	for i, e := range conns {
+		c := sub.Conns[i]
+		if c.Name != e.name || c.Expr != e.expr || c.Implicit != e.implicit {
+			t.Errorf("connection %d: expected %v, but got %+v", i, e, c)
+		}
+	}
+	sub2 := top.Instance("u_sub2")
+	if len(sub2.Conns) != 3 || sub2.Conns[1].Expr != "" || sub2.Conns[2].Expr != "n2" || sub2.Conns[0].Named() {
+		t.Errorf("Unexpected positional connections of u_sub2: %+v", sub2.Conns)
+	}
+
+	udp := f.Unit("udp_dff")
+	if udp.Kind != "primitive" || udp.ANSI || len(udp.Ports) != 3 {
+		t.Fatalf("Unexpected primitive: %+v", udp)
+	}
+	if got := udp.Ports[0]; got.Dir != "output" || got.Type != "reg" {
+		t.Errorf("Expected output reg out, but got %q", got.DeclText())
+	}
+
+	old := f.Unit("old")
+	if old.Kind != "macromodule" || !old.IsModule() {
+		t.Fatalf("Unexpected macromodule: %+v", old)
+	}
+	decls := []string{"input [3:0] a", "input b", "output wire c"}
+	for i, e := range decls {
+		if got := old.Ports[i].DeclText(); got != e {
+			t.Errorf("port %d: expected %q, but got %q", i, e, got)
+		}
+	}
+	if got := old.Ports[2].Decl.Span.Text(sample); got != "output c;" {
+		t.Errorf("Unexpected declaration of port c: %q", got)
+	}
+}
+
+func TestParseUnterminated(t *testing.T) {
+	f, err := Parse("module a; endmodule\nmodule b; wire w;")
+	if err == nil {
+		t.Errorf("Expected an error for the unterminated module")
+	}
+	if len(f.Units) != 1 || f.Units[0].Name != "a" {
+		t.Errorf("Expected module a to be parsed, but got %+v", f.Units)
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	if _, err := Parse("module m;\n  and #"); err == nil {
+		t.Errorf("Expected an error for the truncated gate instance")
+	}
+
+	// no prefix of a source may crash the parser
+	src := "module m #(parameter W = 8) (input [W-1:0] a, output q);\n" +
+		"  and #1 g1 (q, a[0], a[1]);\n" +
+		"  sub #(.W(W)) u0 (.a(a), .q()), u1 (a, q);\n" +
+		"endmodule\n"
+	for i := range src {
+		Parse(src[:i])
+	}
+}
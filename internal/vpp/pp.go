@@ -0,0 +1,452 @@
+// Package vpp implements the Verilog preprocessor directives.
+//
+// It handles `define, `undef, `ifdef, `ifndef, `elsif, `else, `endif and
+// `include, and expands the text macros. The other compiler directives like
+// `timescale are kept as they are. Preprocess returns the text seen by the
+// compiler, and Inactive the spans of the source excluded by the conditional
+// directives, so the raw text can be edited in the active code only.
+package vpp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhuzhzh/vmod/internal/vlex"
+)
+
+// Config holds the macros defined before the source, like +define+, and the
+// directories searched for the included files, like +incdir+.
+type Config struct {
+	// Defines maps the macro names to their text, which may be empty.
+	Defines map[string]string
+	IncDirs []string
+}
+
+// Span is the byte range [Start, End) of a piece of the source.
+type Span struct {
+	Start int
+	End   int
+}
+
+// maxDepth limits the nesting of the included files and macro expansions,
+// which catches the recursive ones.
+const maxDepth = 64
+
+// ParseDefines turns the NAME and NAME=VALUE items, as given to +define+, into
+// the Defines of a Config.
+func ParseDefines(list []string) map[string]string {
+	defines := map[string]string{}
+	for _, item := range list {
+		name, value, _ := strings.Cut(item, "=")
+		if name = strings.TrimSpace(name); name != "" {
+			defines[name] = value
+		}
+	}
+	return defines
+}
+
+// Preprocess returns src, read from file, with the directives applied: the
+// inactive branches of the conditionals and the directives handled here are
+// dropped, keeping their line breaks, the included files are inserted and the
+// macros are expanded.
+func Preprocess(src string, file string, cfg Config) (string, error) {
+	return NewPreprocessor(cfg).Preprocess(src, file)
+}
+
+// Inactive returns the spans of src, read from file, in the branches of the
+// conditional directives that are not compiled with the macros of cfg and the
+// ones defined along the way. The directives themselves are not included.
+// The included files are read for their macros only, and skipped when they
+// cannot be found.
+func Inactive(src string, file string, cfg Config) ([]Span, error) {
+	return NewPreprocessor(cfg).Inactive(src, file)
+}
+
+// Preprocessor works on the files of one compilation unit in order, so the
+// macros defined by a file are seen by the next ones.
+type Preprocessor struct {
+	s *state
+}
+
+// NewPreprocessor returns a Preprocessor starting with the macros of cfg.
+func NewPreprocessor(cfg Config) *Preprocessor {
+	return &Preprocessor{newState(cfg)}
+}
+
+// Preprocess is like the Preprocess function, with the macros defined so far.
+func (p *Preprocessor) Preprocess(src string, file string) (string, error) {
+	var out strings.Builder
+	err := p.s.process(src, file, &out, nil)
+	return out.String(), err
+}
+
+// Inactive is like the Inactive function, with the macros defined so far.
+func (p *Preprocessor) Inactive(src string, file string) ([]Span, error) {
+	var spans []Span
+	err := p.s.process(src, file, nil, &spans)
+	return spans, err
+}
+
+type param struct {
+	name string
+	// def is the default value of the parameter, if hasDef.
+	def    string
+	hasDef bool
+}
+
+type macro struct {
+	// params is nil for the macros without arguments.
+	params []param
+	body   string
+}
+
+type state struct {
+	cfg    Config
+	macros map[string]*macro
+	depth  int
+}
+
+func newState(cfg Config) *state {
+	s := &state{cfg: cfg, macros: map[string]*macro{}}
+	for name, value := range cfg.Defines {
+		s.macros[name] = &macro{body: value}
+	}
+	return s
+}
+
+// cond is one level of nested conditional directives.
+type cond struct {
+	// parent is set when the enclosing code is active, taken when one of
+	// the branches was active.
+	active, taken, parent bool
+}
+
+// process preprocesses src, writing the result to out when it is not nil and
+// adding the inactive spans to inactive when it is not nil.
+func (s *state) process(src string, file string, out *strings.Builder, inactive *[]Span) error {
+	emit := func(text string) {
+		if out != nil {
+			out.WriteString(text)
+		}
+	}
+	// drop keeps the line breaks of text only
+	drop := func(text string) {
+		emit(strings.Repeat("\n", strings.Count(text, "\n")))
+	}
+
+	var conds []cond
+	active := func() bool {
+		return len(conds) == 0 || conds[len(conds)-1].active
+	}
+	toks := vlex.Lex(src)
+	for i := 0; i < len(toks); i++ {
+		tok := toks[i]
+		if tok.Kind != vlex.Directive {
+			if active() {
+				emit(tok.Text)
+				continue
+			}
+			drop(tok.Text)
+			if inactive != nil {
+				addSpan(inactive, Span{tok.Pos, tok.End()})
+			}
+			continue
+		}
+
+		name := tok.Text[1:]
+		switch name {
+		case "ifdef", "ifndef", "elsif":
+			j := nextSignificant(toks, i)
+			if j < 0 || !isName(toks[j]) {
+				return fmt.Errorf("%s:%d: missing macro name after %s", file, line(src, tok.Pos), tok.Text)
+			}
+			_, defined := s.macros[toks[j].Name()]
+			if name == "elsif" {
+				if len(conds) == 0 {
+					return fmt.Errorf("%s:%d: %s without `ifdef", file, line(src, tok.Pos), tok.Text)
+				}
+				c := &conds[len(conds)-1]
+				c.active = c.parent && !c.taken && defined
+				c.taken = c.taken || c.active
+			} else {
+				on := active() && defined == (name == "ifdef")
+				conds = append(conds, cond{active: on, taken: on, parent: active()})
+			}
+			drop(src[tok.Pos:toks[j].End()])
+			i = j
+			continue
+		case "else":
+			if len(conds) == 0 {
+				return fmt.Errorf("%s:%d: `else without `ifdef", file, line(src, tok.Pos))
+			}
+			c := &conds[len(conds)-1]
+			c.active = c.parent && !c.taken
+			c.taken = true
+			continue
+		case "endif":
+			if len(conds) == 0 {
+				return fmt.Errorf("%s:%d: `endif without `ifdef", file, line(src, tok.Pos))
+			}
+			conds = conds[:len(conds)-1]
+			continue
+		}
+
+		if !active() {
+			drop(tok.Text)
+			if inactive != nil {
+				addSpan(inactive, Span{tok.Pos, tok.End()})
+			}
+			continue
+		}
+		switch name {
+		case "define":
+			end := defineEnd(src, tok.End())
+			if err := s.define(src[tok.End():end]); err != nil {
+				return fmt.Errorf("%s:%d: %s", file, line(src, tok.Pos), err)
+			}
+			drop(src[tok.Pos:end])
+			toks, i = skipTo(src, toks, i, end)
+		case "undef":
+			j := nextSignificant(toks, i)
+			if j < 0 || !isName(toks[j]) {
+				return fmt.Errorf("%s:%d: missing macro name after `undef", file, line(src, tok.Pos))
+			}
+			delete(s.macros, toks[j].Name())
+			i = j
+		case "include":
+			j := nextSignificant(toks, i)
+			if j < 0 || toks[j].Kind != vlex.String {
+				return fmt.Errorf("%s:%d: missing file name after `include", file, line(src, tok.Pos))
+			}
+			if err := s.include(strings.Trim(toks[j].Text, `"`), file, out); err != nil {
+				return fmt.Errorf("%s:%d: %s", file, line(src, tok.Pos), err)
+			}
+			i = j
+		default:
+			m, ok := s.macros[name]
+			if !ok {
+				// `timescale and the like, or an undefined macro
+				emit(tok.Text)
+				continue
+			}
+			text, j, err := expandMacro(m, toks, i)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %s: %s", file, line(src, tok.Pos), tok.Text, err)
+			}
+			if s.depth++; s.depth > maxDepth {
+				return fmt.Errorf("%s:%d: %s: recursive macro", file, line(src, tok.Pos), tok.Text)
+			}
+			err = s.process(text, file, out, nil)
+			s.depth--
+			if err != nil {
+				return err
+			}
+			i = j
+		}
+	}
+	if len(conds) > 0 {
+		return fmt.Errorf("%s: missing `endif", file)
+	}
+	return nil
+}
+
+// addSpan adds the span to spans, merging it with the last one when they
+// touch.
+func addSpan(spans *[]Span, span Span) {
+	if n := len(*spans); n > 0 && (*spans)[n-1].End == span.Start {
+		(*spans)[n-1].End = span.End
+		return
+	}
+	*spans = append(*spans, span)
+}
+
+// define records the macro defined by text, the part of the `define line
+// after the directive.
+func (s *state) define(text string) error {
+	text = strings.ReplaceAll(text, "\\\r\n", "\n")
+	text = strings.ReplaceAll(text, "\\\n", "\n")
+	text = strings.TrimLeft(text, " \t")
+	n := 0
+	for n < len(text) && (isNameChar(text[n]) || n == 0 && text[n] == '\\') {
+		n++
+	}
+	if n == 0 {
+		return fmt.Errorf("missing macro name after `define")
+	}
+	name, rest := text[:n], text[n:]
+
+	m := &macro{}
+	if strings.HasPrefix(rest, "(") {
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return fmt.Errorf("missing ) in the arguments of %s", name)
+		}
+		m.params = []param{}
+		for _, item := range strings.Split(rest[1:end], ",") {
+			p := param{}
+			p.name, p.def, p.hasDef = strings.Cut(item, "=")
+			p.name, p.def = strings.TrimSpace(p.name), strings.TrimSpace(p.def)
+			m.params = append(m.params, p)
+		}
+		rest = rest[end+1:]
+	}
+
+	// the line comments are not part of the macro text
+	var body strings.Builder
+	for _, tok := range vlex.Lex(rest) {
+		if tok.Kind != vlex.Comment || !strings.HasPrefix(tok.Text, "//") {
+			body.WriteString(tok.Text)
+		}
+	}
+	m.body = strings.TrimSpace(body.String())
+	s.macros[name] = m
+	return nil
+}
+
+// include processes the file name included from the file from. The file is
+// searched in the directory of from, then in the include directories.
+func (s *state) include(name string, from string, out *strings.Builder) error {
+	dirs := append([]string{filepath.Dir(from)}, s.cfg.IncDirs...)
+	if filepath.IsAbs(name) {
+		dirs = []string{""}
+	}
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if s.depth++; s.depth > maxDepth {
+			return fmt.Errorf("recursive include of %s", name)
+		}
+		defer func() { s.depth-- }()
+		return s.process(string(data), path, out, nil)
+	}
+	if out == nil {
+		// only looking for the macros
+		return nil
+	}
+	return fmt.Errorf("cannot find the included file %s", name)
+}
+
+// expandMacro returns the text of the macro m used by the directive toks[i],
+// with its arguments substituted, and the index of the last token of the
+// macro usage.
+func expandMacro(m *macro, toks []vlex.Token, i int) (string, int, error) {
+	if m.params == nil {
+		return m.body, i, nil
+	}
+	j := nextSignificant(toks, i)
+	if j < 0 || !toks[j].Is("(") {
+		return "", i, fmt.Errorf("missing arguments")
+	}
+
+	var args []string
+	var arg strings.Builder
+	depth := 0
+	for j++; j < len(toks); j++ {
+		t := toks[j]
+		switch {
+		case t.Is("(") || t.Is("[") || t.Is("{"):
+			depth++
+		case (t.Is(")") || t.Is("]") || t.Is("}")) && depth > 0:
+			depth--
+		case t.Is(")"), t.Is(",") && depth == 0:
+			args = append(args, strings.TrimSpace(arg.String()))
+			arg.Reset()
+			if t.Is(")") {
+				return substitute(m, args), j, nil
+			}
+			continue
+		}
+		arg.WriteString(t.Text)
+	}
+	return "", i, fmt.Errorf("missing ) after the arguments")
+}
+
+// substitute returns the body of m with its parameters replaced by args.
+func substitute(m *macro, args []string) string {
+	values := map[string]string{}
+	for k, p := range m.params {
+		switch {
+		case k < len(args) && args[k] != "":
+			values[p.name] = args[k]
+		case p.hasDef:
+			values[p.name] = p.def
+		default:
+			values[p.name] = ""
+		}
+	}
+	// `` pastes the tokens around it
+	parts := strings.Split(m.body, "``")
+	for k, part := range parts {
+		var b strings.Builder
+		for _, tok := range vlex.Lex(part) {
+			if value, ok := values[tok.Text]; ok && tok.IsIdent() {
+				b.WriteString(value)
+			} else {
+				b.WriteString(tok.Text)
+			}
+		}
+		parts[k] = b.String()
+	}
+	return strings.Join(parts, "")
+}
+
+// defineEnd returns the end of the `define line starting at pos, following
+// the backslash line continuations. The line break is not included.
+func defineEnd(src string, pos int) int {
+	for {
+		n := strings.IndexByte(src[pos:], '\n')
+		if n < 0 {
+			return len(src)
+		}
+		end := pos + n
+		if !strings.HasSuffix(strings.TrimSuffix(src[pos:end], "\r"), "\\") {
+			return end
+		}
+		pos = end + 1
+	}
+}
+
+// skipTo returns the tokens and the index of the last token before the offset
+// end, lexing the source again from end when a token crosses it.
+func skipTo(src string, toks []vlex.Token, i int, end int) ([]vlex.Token, int) {
+	for i+1 < len(toks) && toks[i+1].Pos < end {
+		i++
+	}
+	if toks[i].End() <= end {
+		return toks, i
+	}
+	rest := vlex.Lex(src[end:])
+	for k := range rest {
+		rest[k].Pos += end
+	}
+	return append(toks[:i:i], rest...), i - 1
+}
+
+// nextSignificant returns the index of the first token after toks[i] which is
+// not blank or a comment, or -1.
+func nextSignificant(toks []vlex.Token, i int) int {
+	for j := i + 1; j < len(toks); j++ {
+		if !toks[j].IsTrivia() {
+			return j
+		}
+	}
+	return -1
+}
+
+func isName(tok vlex.Token) bool {
+	return tok.IsIdent() || tok.Kind == vlex.Keyword
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// line returns the line number of the offset pos of src.
+func line(src string, pos int) int {
+	return strings.Count(src[:pos], "\n") + 1
+}
@@ -0,0 +1,122 @@
+package vpp
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPreprocessConditionals(t *testing.T) {
+	src := "`define FAST\n" +
+		"`ifdef FAST\n" +
+		"wire a;\n" +
+		"`elsif SLOW\n" +
+		"wire b;\n" +
+		"`else\n" +
+		"wire c;\n" +
+		"`endif\n" +
+		"`ifndef FAST\n" +
+		"wire d;\n" +
+		"`endif\n" +
+		"`timescale 1ns/1ps\n"
+	got, err := Preprocess(src, "a.v", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "\n\nwire a;\n\n\n\n\n\n\n\n\n`timescale 1ns/1ps\n"
+	if got != expect {
+		t.Errorf("Expected %q, got %q", expect, got)
+	}
+	if strings.Count(got, "\n") != strings.Count(src, "\n") {
+		t.Errorf("Expected the lines to be kept, got %q", got)
+	}
+
+	got, err = Preprocess(src, "a.v", Config{Defines: ParseDefines([]string{"SLOW"})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "wire a;") || strings.Contains(got, "wire b;") {
+		t.Errorf("Expected the first taken branch only, got %q", got)
+	}
+}
+
+func TestPreprocessMacros(t *testing.T) {
+	src := "`define W 8\n" +
+		"`define REG(name, w = `W) \\\n" +
+		"  reg [w-1:0] name; // comment\n" +
+		"`define CAT(a, b) a``b\n" +
+		"`REG(q)\n" +
+		"`REG(r, 4)\n" +
+		"wire `CAT(n, 1);\n" +
+		"`undef W\n" +
+		"wire [`W:0] s;\n"
+	got, err := Preprocess(src, "a.v", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "\n\n\n\nreg [8-1:0] q;\nreg [4-1:0] r;\nwire n1;\n\nwire [`W:0] s;\n"
+	if got != expect {
+		t.Errorf("Expected %q, got %q", expect, got)
+	}
+
+	if _, err := Preprocess("`define A `A\n`A\n", "a.v", Config{}); err == nil {
+		t.Errorf("Expected an error for a recursive macro")
+	}
+	if _, err := Preprocess("`ifdef A\n", "a.v", Config{}); err == nil {
+		t.Errorf("Expected an error for a missing `endif")
+	}
+}
+
+func TestPreprocessInclude(t *testing.T) {
+	dir := t.TempDir()
+	inc := filepath.Join(dir, "inc")
+	if err := os.Mkdir(inc, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(inc, "defs.vh"), []byte("`define WIDTH 16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := "`include \"defs.vh\"\nwire [`WIDTH-1:0] a;\n"
+
+	if _, err := Preprocess(src, filepath.Join(dir, "a.v"), Config{}); err == nil {
+		t.Errorf("Expected an error for a missing include file")
+	}
+	got, err := Preprocess(src, filepath.Join(dir, "a.v"), Config{IncDirs: []string{inc}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "\n\nwire [16-1:0] a;\n"; got != expect {
+		t.Errorf("Expected %q, got %q", expect, got)
+	}
+}
+
+func TestInactive(t *testing.T) {
+	src := "`ifdef SIM\n" +
+		"initial $display(\"sim\");\n" +
+		"`else\n" +
+		"wire a;\n" +
+		"`endif\n"
+	spans, err := Inactive(src, "a.v", Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := strings.Index(src, "\ninitial")
+	expect := []Span{{start, strings.Index(src, "`else")}}
+	if !reflect.DeepEqual(spans, expect) {
+		t.Errorf("Expected %v, got %v", expect, spans)
+	}
+
+	// the missing include file is skipped
+	src = "`include \"none.vh\"\n" + src
+	spans, err = Inactive(src, "a.v", Config{Defines: map[string]string{"SIM": ""}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start = strings.Index(src, "\nwire")
+	expect = []Span{{start, strings.Index(src, "`endif")}}
+	if !reflect.DeepEqual(spans, expect) {
+		t.Errorf("Expected the else branch %v to be inactive, got %v", expect, spans)
+	}
+}
@@ -0,0 +1,93 @@
+package vtext
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+// checkReplacement compares the interface of the replaced design unit with
+// the one of the replacement text, as selected by op.CheckPorts.
+func checkReplacement(old string, repl string, op Opcode) error {
+	f, _ := vparse.Parse(old)
+	if len(f.Units) != 1 {
+		log.WithFields(log.Fields{
+			"file":  op.File,
+			"block": strings.Join(strings.Fields(old[:strings.IndexByte(old+"\n", '\n')]), " "),
+		}).Warn("The replaced block is not a design unit, its ports are not checked")
+		return nil
+	}
+	u := f.Units[0]
+
+	var issues []string
+	rf, _ := vparse.Parse(repl)
+	r := rf.Unit(u.Name)
+	switch {
+	case r == nil && len(rf.Units) == 1:
+		r = rf.Units[0]
+		issues = append(issues, fmt.Sprintf("%s %s is renamed to %s", u.Kind, u.Name, r.Name))
+	case r == nil:
+		issues = append(issues, fmt.Sprintf("the replacement does not declare %s %s", u.Kind, u.Name))
+	}
+	if r != nil {
+		issues = append(issues, portIssues(u, r)...)
+	}
+	if len(issues) == 0 {
+		return nil
+	}
+
+	if op.CheckPorts == "error" {
+		return fmt.Errorf("%s %s: %s", u.Kind, u.Name, strings.Join(issues, "; "))
+	}
+	for _, issue := range issues {
+		log.WithFields(log.Fields{
+			"file": op.File,
+			"unit": u.Name,
+		}).Warn(issue)
+	}
+	return nil
+}
+
+// portIssues lists the differences between the ports of u and of its
+// replacement r. A port missing from r whose position holds a port unknown
+// to u is reported as renamed.
+func portIssues(u *vparse.Unit, r *vparse.Unit) []string {
+	var issues []string
+	for i, port := range u.Ports {
+		rp := r.Port(port.Name)
+		if rp == nil {
+			if i < len(r.Ports) && u.Port(r.Ports[i].Name) == nil {
+				issues = append(issues, fmt.Sprintf("port %s is renamed to %s", port.Name, r.Ports[i].Name))
+			} else {
+				issues = append(issues, fmt.Sprintf("port %s is missing", port.Name))
+			}
+			continue
+		}
+		if port.Dir != rp.Dir {
+			issues = append(issues, fmt.Sprintf("port %s changes direction from %s to %s", port.Name, orNone(port.Dir), orNone(rp.Dir)))
+		}
+		if stripSpace(port.Range) != stripSpace(rp.Range) {
+			issues = append(issues, fmt.Sprintf("port %s changes width from %s to %s", port.Name, orNone(port.Range), orNone(rp.Range)))
+		}
+	}
+	for i, rp := range r.Ports {
+		renamed := i < len(u.Ports) && r.Port(u.Ports[i].Name) == nil
+		if u.Port(rp.Name) == nil && !renamed {
+			issues = append(issues, fmt.Sprintf("port %s is extra", rp.Name))
+		}
+	}
+	return issues
+}
+
+func stripSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
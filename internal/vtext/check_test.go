@@ -0,0 +1,67 @@
+package vtext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckPorts(t *testing.T) {
+	text := "module m (input [7:0] a, input b, input c, output q);\nendmodule\n"
+	cases := []struct {
+		repl   string
+		issues []string
+	}{
+		{"module m (input [7:0] a, input b, input c, output q); endmodule", nil},
+		{"module m (input [ 7 : 0 ] a, input b, input c, output q); endmodule", nil},
+		{"module m (input [3:0] a, input b, output c, output q, input d); endmodule", []string{
+			"port a changes width from [7:0] to [3:0]",
+			"port c changes direction from input to output",
+			"port d is extra",
+		}},
+		{"module m (input [7:0] a, input b, input c); endmodule", []string{"port q is missing"}},
+		{"module m (input [7:0] a, input b2, input c, output q); endmodule", []string{"port b is renamed to b2"}},
+		{"module n (input [7:0] a, input b, input c, output q); endmodule", []string{"module m is renamed to n"}},
+		{"wire w;", []string{"the replacement does not declare module m"}},
+	}
+	for _, c := range cases {
+		op := Opcode{Unit: &Unit{Name: "m"}, Text: Lines(c.repl), CheckPorts: "error"}
+		_, err := ReplaceAction(text, op)
+		if len(c.issues) == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", c.repl, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error", c.repl)
+			continue
+		}
+		for _, issue := range c.issues {
+			if !strings.Contains(err.Error(), issue) {
+				t.Errorf("%s: expected %q in %q", c.repl, issue, err)
+			}
+		}
+
+		op.CheckPorts = "warn"
+		if _, err := ReplaceAction(text, op); err != nil {
+			t.Errorf("%s: unexpected error %v with warn", c.repl, err)
+		}
+	}
+}
+
+func TestCheckPortsMissingUnit(t *testing.T) {
+	text := "module m (input a);\nendmodule\n"
+	repl := Lines("module n (); endmodule module o (); endmodule")
+
+	// a unit selection takes the unit of the same name, whatever the check
+	op := Opcode{Unit: &Unit{Name: "m"}, Text: repl, CheckPorts: "warn"}
+	if _, err := ReplaceAction(text, op); err == nil || !strings.Contains(err.Error(), "the replacement text does not declare m") {
+		t.Errorf("Expected a missing unit error, got %v", err)
+	}
+
+	// a begin/end block is checked against the unit of the same name
+	op = Opcode{Begin: "module m", End: "endmodule", Text: repl, CheckPorts: "error"}
+	if _, err := ReplaceAction(text, op); err == nil || !strings.Contains(err.Error(), "the replacement does not declare module m") {
+		t.Errorf("Expected a missing unit issue, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package vtext
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+// edit replaces the text of a span of the source.
+type edit struct {
+	vparse.Span
+	text string
+}
+
+// applyEdits returns src with the edits applied. The edits must not overlap;
+// insertions at the same position keep their order.
+func applyEdits(src string, edits []edit) string {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].Start < edits[j].Start
+	})
+	var b strings.Builder
+	var start int
+	for _, e := range edits {
+		b.WriteString(src[start:e.Start])
+		b.WriteString(e.text)
+		start = e.End
+	}
+	b.WriteString(src[start:])
+	return b.String()
+}
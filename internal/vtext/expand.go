@@ -0,0 +1,112 @@
+package vtext
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+// expand replaces the ${name} references in text with their value in vars,
+// or else with the environment variable name. References to unknown names
+// are kept as they are.
+func expand(text string, vars map[string]string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(text, "${")
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(text[i:], '}')
+		if j < 0 {
+			break
+		}
+		b.WriteString(text[:i])
+		name := text[i+2 : i+j]
+		if value, ok := vars[name]; ok {
+			b.WriteString(value)
+		} else if value, ok := os.LookupEnv(name); ok {
+			b.WriteString(value)
+		} else {
+			b.WriteString(text[i : i+j+1])
+		}
+		text = text[i+j+1:]
+	}
+	b.WriteString(text)
+	return b.String()
+}
+
+// templateVars returns the variables the replacement text of the block b of
+// src may refer to: the variables of the block, the matched text, the file
+// name, the index of the block in the file and, when the block is a design
+// unit, its kind, name, ports and parameters.
+func templateVars(src string, file string, index int, b block) map[string]string {
+	vars := map[string]string{
+		"match": src[b.beginIndex:b.endIndex],
+		"file":  file,
+		"index": strconv.Itoa(index),
+	}
+	if f, _ := vparse.Parse(vars["match"]); len(f.Units) == 1 {
+		addUnitVars(vars, f.Units[0])
+	}
+	// the variables of the block win over the ones computed here
+	for k, v := range b.vars {
+		vars[k] = v
+	}
+	return vars
+}
+
+// addUnitVars sets the template variables describing the design unit u.
+func addUnitVars(vars map[string]string, u *vparse.Unit) {
+	vars["kind"], vars["name"] = u.Kind, u.Name
+
+	var ports, portDecls, portConns []string
+	for _, port := range u.Ports {
+		ports = append(ports, port.Name)
+		portDecls = append(portDecls, port.DeclText())
+		portConns = append(portConns, "."+port.Name+"("+port.Name+")")
+	}
+	vars["ports"] = strings.Join(ports, ", ")
+	vars["port_decls"] = strings.Join(portDecls, ",\n  ")
+	vars["port_conns"] = strings.Join(portConns, ",\n  ")
+
+	var params, paramDecls, overrides []string
+	for _, param := range u.Params {
+		if param.Kind != "parameter" {
+			continue
+		}
+		params = append(params, param.Name)
+		decl := strings.Join(strings.Fields(param.Kind+" "+param.Type+" "+param.Name), " ")
+		if param.Value != "" {
+			decl += " = " + param.Value
+		}
+		paramDecls = append(paramDecls, decl)
+		overrides = append(overrides, "."+param.Name+"("+param.Name+")")
+	}
+	vars["params"] = strings.Join(params, ", ")
+	vars["param_decls"] = strings.Join(paramDecls, ", ")
+	vars["param_overrides"] = strings.Join(overrides, ", ")
+
+	// with the #( ) wrapper and a space, or empty for the units without
+	// parameters, which cannot have an empty #()
+	vars["param_port_list"], vars["param_value_assignment"] = "", ""
+	if len(params) > 0 {
+		vars["param_port_list"] = "#(" + vars["param_decls"] + ") "
+		vars["param_value_assignment"] = "#(" + vars["param_overrides"] + ") "
+	}
+}
+
+// blockMarker returns the text following the action in the comment left in
+// place of the block, e.g. "// replace <marker>". The opcode marker may
+// refer to the variables of the block; otherwise regular expression blocks
+// show what the begin expression matched and literal ones show keyword.
+func blockMarker(op Opcode, b block, keyword string) string {
+	if op.Marker != "" {
+		return expand(op.Marker, b.vars)
+	}
+	if begin, ok := b.vars["0"]; ok {
+		return strings.Join(strings.Fields(begin), " ")
+	}
+	return keyword
+}
@@ -0,0 +1,98 @@
+package vtext
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+// InsertAction inserts the text of the opcode, given inline or by its source
+// file, around or inside each block as selected by op.Op: insert_before,
+// insert_after, insert_at_start (after the header of a design unit) or
+// insert_at_end (before its end keyword). For blocks which are not design
+// units, the start is after the first line and the end before the last one.
+func InsertAction(fileContent string, op Opcode) (string, error) {
+	log.WithFields(log.Fields{
+		"op":      op.Op,
+		"begin":   op.Begin,
+		"end":     op.End,
+		"beginRe": op.BeginRe,
+		"endRe":   op.EndRe,
+		"nested":  op.Nested,
+		"unit":    op.Unit,
+	}).Debug("Inserting content around begin and end indices")
+
+	switch op.Op {
+	case "insert_before", "insert_after", "insert_at_start", "insert_at_end":
+	default:
+		return "", fmt.Errorf("unknown insert position: %s", op.Op)
+	}
+	text, err := replacement(op)
+	if err != nil {
+		return "", err
+	}
+	occurs, err := findBlocks(fileContent, op)
+	if err != nil {
+		return "", err
+	}
+
+	var edits []edit
+	for i, pair := range occurs {
+		vars := templateVars(fileContent, op.File, i, pair)
+		edits = append(edits, insertLines(fileContent, insertPos(fileContent, op.Op, pair), expand(text, vars)))
+	}
+	return applyEdits(fileContent, edits), nil
+}
+
+// insertPos returns where the insert operation puts its text for the block.
+func insertPos(src string, op string, b block) int {
+	switch op {
+	case "insert_before":
+		return b.beginIndex
+	case "insert_after":
+		return b.endIndex
+	}
+
+	content := src[b.beginIndex:b.endIndex]
+	if f, _ := vparse.Parse(content); len(f.Units) == 1 {
+		if op == "insert_at_start" {
+			return b.beginIndex + f.Units[0].Header.End
+		}
+		return b.beginIndex + f.Units[0].EndSpan.Start
+	}
+	if op == "insert_at_start" {
+		if i := strings.IndexByte(content, '\n'); i >= 0 {
+			return b.beginIndex + i
+		}
+		return b.endIndex
+	}
+	return b.beginIndex + strings.LastIndexByte(content, '\n') + 1
+}
+
+// insertLines returns the edit inserting text at pos as whole lines: at the
+// start of the line when only blanks precede pos, after the end of the line
+// when only blanks or comments follow it, or else on a line of its own
+// splitting the line, without the blanks around pos.
+func insertLines(src string, pos int, text string) edit {
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	lineStart := strings.LastIndexByte(src[:pos], '\n') + 1
+	if strings.TrimSpace(src[lineStart:pos]) == "" {
+		return edit{vparse.Span{Start: lineStart, End: lineStart}, text}
+	}
+	lineEnd := strings.IndexByte(src[pos:], '\n')
+	if lineEnd < 0 {
+		if strings.TrimSpace(src[pos:]) == "" || trailingComment(src, pos) > pos {
+			return edit{vparse.Span{Start: len(src), End: len(src)}, "\n" + text}
+		}
+	} else if strings.TrimSpace(src[pos:pos+lineEnd]) == "" || trailingComment(src, pos) > pos {
+		end := pos + lineEnd + 1
+		return edit{vparse.Span{Start: end, End: end}, text}
+	}
+	start := len(strings.TrimRight(src[:pos], " \t"))
+	end := len(src) - len(strings.TrimLeft(src[pos:], " \t"))
+	return edit{vparse.Span{Start: start, End: end}, "\n" + text}
+}
@@ -0,0 +1,47 @@
+package vtext
+
+import (
+	"testing"
+)
+
+func TestInsertAction(t *testing.T) {
+	text := `module foo (input a);
+  wire b;
+endmodule
+module bar; endmodule
+`
+	cases := []struct {
+		op     string
+		expect string
+	}{
+		{"insert_before", "// foo\nmodule foo (input a);\n  wire b;\nendmodule\n// bar\nmodule bar; endmodule\n"},
+		{"insert_after", "module foo (input a);\n  wire b;\nendmodule\n// foo\nmodule bar; endmodule\n// bar\n"},
+		{"insert_at_start", "module foo (input a);\n// foo\n  wire b;\nendmodule\nmodule bar;\n// bar\nendmodule\n"},
+		{"insert_at_end", "module foo (input a);\n  wire b;\n// foo\nendmodule\nmodule bar;\n// bar\nendmodule\n"},
+	}
+	for _, c := range cases {
+		got, err := InsertAction(text, Opcode{Op: c.op, Unit: &Unit{Name: "*"}, Text: "// ${name}"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.expect {
+			t.Errorf("%s: expected\n[%s]\nbut got\n[%s]", c.op, c.expect, got)
+		}
+	}
+
+	got, err := InsertAction(text, Opcode{Op: "insert_at_end", Begin: "module foo", End: "endmodule", Text: "  wire c;"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "module foo (input a);\n  wire b;\n  wire c;\nendmodule\nmodule bar; endmodule\n"; got != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got)
+	}
+
+	got, err = InsertAction("module foo(input a); // hdr\nendmodule\n", Opcode{Op: "insert_at_start", Unit: &Unit{Name: "foo"}, Text: "  // added ${name}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "module foo(input a); // hdr\n  // added foo\nendmodule\n"; got != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got)
+	}
+}
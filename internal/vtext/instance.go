@@ -0,0 +1,229 @@
+package vtext
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+// instanceOps are the operations on instances: rminst removes them,
+// renameinst renames them to op.To and remaster changes their master to
+// op.To, keeping their parameters and connections.
+var instanceOps = map[string]bool{"rminst": true, "renameinst": true, "remaster": true}
+
+// InstanceAction applies the instance operation op.Op on the instances
+// selected by op.Instance: either a hierarchical name like "top.u_core.u0",
+// going down from the unit top, or a local name or glob pattern of instances
+// of the units selected by op.Unit. A hierarchical name edits the unit the
+// instance is declared in, so every instance of that unit sees the change.
+func InstanceAction(sources []Source, op Opcode) ([]Source, error) {
+	log.WithFields(log.Fields{
+		"op":       op.Op,
+		"unit":     op.Unit,
+		"instance": op.Instance,
+		"to":       op.To,
+	}).Debug("Editing instances")
+
+	switch {
+	case !instanceOps[op.Op]:
+		return nil, fmt.Errorf("unknown instance operation: %s", op.Op)
+	case op.Instance == "":
+		return nil, fmt.Errorf("missing instance")
+	case op.Op != "rminst" && op.To == "":
+		return nil, fmt.Errorf("missing to")
+	}
+
+	files := make([]*vparse.File, len(sources))
+	for i, src := range sources {
+		files[i] = parseSource(src.Content, src.File)
+	}
+	selected, err := selectInstances(files, op)
+	if err != nil {
+		return nil, err
+	}
+	if len(selected) == 0 {
+		log.WithFields(log.Fields{
+			"unit":     op.Unit,
+			"instance": op.Instance,
+		}).Warn("No instance found")
+	}
+
+	edits := make([][]edit, len(sources))
+	for i, f := range files {
+		for _, u := range f.Units {
+			e, err := instanceEdits(sources[i].Content, u, selected, op)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", sources[i].File, err)
+			}
+			edits[i] = append(edits[i], e...)
+		}
+	}
+	return applySourceEdits(sources, edits), nil
+}
+
+// selectInstances returns the instances selected by op in files.
+func selectInstances(files []*vparse.File, op Opcode) (map[*vparse.Instance]bool, error) {
+	selected := map[*vparse.Instance]bool{}
+	names := instancePath(op.Instance)
+	if len(names) == 1 {
+		if op.Unit == nil {
+			return nil, fmt.Errorf("missing unit of the local instance %s", op.Instance)
+		}
+		escaped := strings.HasPrefix(op.Instance, "\\")
+		for _, f := range files {
+			for _, u := range f.Units {
+				if !op.Unit.Match(u) {
+					continue
+				}
+				for _, inst := range u.Instances {
+					// an escaped name is not a pattern
+					if ok, _ := path.Match(names[0], inst.Name); ok && !escaped || inst.Name == names[0] {
+						selected[inst] = true
+					}
+				}
+			}
+		}
+		return selected, nil
+	}
+
+	units := map[string]*vparse.Unit{}
+	for _, f := range files {
+		for _, u := range f.Units {
+			units[u.Name] = u
+		}
+	}
+	u := units[names[0]]
+	if u == nil {
+		return nil, fmt.Errorf("unknown unit %s of %s", names[0], op.Instance)
+	}
+	for k, name := range names[1:] {
+		inst := u.Instance(name)
+		if inst == nil {
+			return nil, fmt.Errorf("no instance %s in %s of %s", name, u.Name, op.Instance)
+		}
+		if k == len(names)-2 {
+			selected[inst] = true
+			break
+		}
+		if u = units[inst.Master]; u == nil {
+			return nil, fmt.Errorf("unknown unit %s of %s", inst.Master, op.Instance)
+		}
+	}
+	return selected, nil
+}
+
+// instancePath splits the hierarchical name of an instance on the dots, but
+// the ones of the escaped identifiers, which end with a blank, like
+// "top.\u_a.b .U1". The names are returned without the backslash.
+func instancePath(name string) []string {
+	var names []string
+	for {
+		if !strings.HasPrefix(name, "\\") {
+			dot := strings.IndexByte(name, '.')
+			if dot < 0 {
+				return append(names, name)
+			}
+			names = append(names, name[:dot])
+			name = name[dot+1:]
+			continue
+		}
+		end := strings.IndexAny(name, " \t")
+		if end < 0 {
+			return append(names, name[1:])
+		}
+		names = append(names, name[1:end])
+		name = strings.TrimLeft(name[end:], " \t")
+		if !strings.HasPrefix(name, ".") {
+			return names
+		}
+		name = name[1:]
+	}
+}
+
+// instanceEdits returns the edits applying op on the selected instances of
+// the unit u of src. Statements declaring several instances are split when
+// only some of them change their master, and shrunk when only some of them
+// are removed.
+func instanceEdits(src string, u *vparse.Unit, selected map[*vparse.Instance]bool, op Opcode) ([]edit, error) {
+	var edits []edit
+	for _, stmt := range instanceStmts(u) {
+		var picked []int
+		for k, inst := range stmt {
+			if selected[inst] {
+				picked = append(picked, k)
+			}
+		}
+		if len(picked) == 0 {
+			continue
+		}
+		all := len(picked) == len(stmt)
+
+		switch op.Op {
+		case "renameinst":
+			if len(picked) > 1 {
+				return nil, fmt.Errorf("%d instances of %s would be renamed to %s", len(picked), u.Name, op.To)
+			}
+			if u.Instance(op.To) != nil {
+				return nil, fmt.Errorf("%s already has an instance %s", u.Name, op.To)
+			}
+			edits = append(edits, edit{stmt[picked[0]].NameSpan, identText(op.To)})
+		case "rminst":
+			if all {
+				edits = append(edits, deleteLine(src, stmt[0].Stmt))
+				continue
+			}
+			edits = append(edits, removeItems(stmt, picked)...)
+		case "remaster":
+			if all {
+				edits = append(edits, edit{stmt[0].MasterSpan, identText(op.To)})
+				continue
+			}
+			edits = append(edits, removeItems(stmt, picked)...)
+			head := identText(op.To)
+			if params := stmt[0].ParamList.Text(src); params != "" {
+				head += " " + params
+			}
+			var lines []string
+			for _, k := range picked {
+				lines = append(lines, lineIndent(src, stmt[0].Stmt.Start)+head+" "+stmt[k].Span.Text(src)+";")
+			}
+			edits = append(edits, insertLines(src, stmt[0].Stmt.End, strings.Join(lines, "\n")))
+		}
+	}
+	return edits, nil
+}
+
+// instanceStmts groups the instances of u by statement.
+func instanceStmts(u *vparse.Unit) [][]*vparse.Instance {
+	var stmts [][]*vparse.Instance
+	for k, inst := range u.Instances {
+		if k > 0 && inst.Stmt == u.Instances[k-1].Stmt {
+			stmts[len(stmts)-1] = append(stmts[len(stmts)-1], inst)
+			continue
+		}
+		stmts = append(stmts, []*vparse.Instance{inst})
+	}
+	return stmts
+}
+
+// removeItems returns the edits removing the picked instances, in order,
+// from their statement, which keeps at least one instance. The leading
+// instances go with the comma following them, the others with the comma
+// preceding them.
+func removeItems(stmt []*vparse.Instance, picked []int) []edit {
+	lead := 0
+	for lead < len(picked) && picked[lead] == lead {
+		lead++
+	}
+	var edits []edit
+	if lead > 0 {
+		edits = append(edits, edit{vparse.Span{Start: stmt[0].Span.Start, End: stmt[lead].Span.Start}, ""})
+	}
+	for _, k := range picked[lead:] {
+		edits = append(edits, edit{vparse.Span{Start: stmt[k-1].Span.End, End: stmt[k].Span.End}, ""})
+	}
+	return edits
+}
@@ -0,0 +1,101 @@
+package vtext
+
+import (
+	"testing"
+)
+
+func TestInstanceAction(t *testing.T) {
+	sources := []Source{
+		{"top.v", `module top (input a, output z);
+  core u_core (.a(a), .z(z));
+endmodule
+`},
+		{"core.v", `module core (input a, output z);
+  wire n1, n2;
+  BUFX2 U1 (.A(a), .Y(n1)), U2 (.A(n1), .Y(n2)), U3 (.A(n2), .Y(z));
+  INVX1 U4 (.A(a), .Y());
+endmodule
+`},
+	}
+	cases := []struct {
+		op     Opcode
+		expect string
+	}{
+		{Opcode{Op: "rminst", Instance: "top.u_core.U4"}, `module core (input a, output z);
+  wire n1, n2;
+  BUFX2 U1 (.A(a), .Y(n1)), U2 (.A(n1), .Y(n2)), U3 (.A(n2), .Y(z));
+endmodule
+`},
+		{Opcode{Op: "rminst", Unit: &Unit{Name: "core"}, Instance: "U[12]"}, `module core (input a, output z);
+  wire n1, n2;
+  BUFX2 U3 (.A(n2), .Y(z));
+  INVX1 U4 (.A(a), .Y());
+endmodule
+`},
+		{Opcode{Op: "renameinst", Instance: "top.u_core.U2", To: "U_mid"}, `module core (input a, output z);
+  wire n1, n2;
+  BUFX2 U1 (.A(a), .Y(n1)), U_mid (.A(n1), .Y(n2)), U3 (.A(n2), .Y(z));
+  INVX1 U4 (.A(a), .Y());
+endmodule
+`},
+		{Opcode{Op: "remaster", Unit: &Unit{Name: "core"}, Instance: "U[23]", To: "BUFX4"}, `module core (input a, output z);
+  wire n1, n2;
+  BUFX2 U1 (.A(a), .Y(n1));
+  BUFX4 U2 (.A(n1), .Y(n2));
+  BUFX4 U3 (.A(n2), .Y(z));
+  INVX1 U4 (.A(a), .Y());
+endmodule
+`},
+		{Opcode{Op: "remaster", Unit: &Unit{Name: "core"}, Instance: "U4", To: "INVX2"}, `module core (input a, output z);
+  wire n1, n2;
+  BUFX2 U1 (.A(a), .Y(n1)), U2 (.A(n1), .Y(n2)), U3 (.A(n2), .Y(z));
+  INVX2 U4 (.A(a), .Y());
+endmodule
+`},
+	}
+	for _, c := range cases {
+		got, err := InstanceAction(sources, c.op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got[0].Content != sources[0].Content || got[1].Content != c.expect {
+			t.Errorf("%s %s: expected\n[%s]\nbut got\n[%s]", c.op.Op, c.op.Instance, c.expect, got[1].Content)
+		}
+	}
+
+	errors := []Opcode{
+		{Op: "rminst", Instance: "U1"},
+		{Op: "rminst", Instance: "top.u_none.U1"},
+		{Op: "renameinst", Unit: &Unit{Name: "core"}, Instance: "U1", To: "U2"},
+		{Op: "remaster", Instance: "top.u_core"},
+	}
+	for _, op := range errors {
+		if _, err := InstanceAction(sources, op); err == nil {
+			t.Errorf("%s %s: expected an error", op.Op, op.Instance)
+		}
+	}
+}
+
+func TestInstanceActionEscaped(t *testing.T) {
+	sources := []Source{
+		{"top.v", "module top;\n  core \\u_core.x  ();\nendmodule\n"},
+		{"core.v", "module core;\n  BUFX2 \\u_a.b  (.A(a)), \\U[1]  (.A(a)), U1 (.A(a));\nendmodule\n"},
+	}
+	cases := []struct {
+		op     Opcode
+		expect string
+	}{
+		{Opcode{Op: "rminst", Instance: "top.\\u_core.x .\\u_a.b "}, "module core;\n  BUFX2 \\U[1]  (.A(a)), U1 (.A(a));\nendmodule\n"},
+		{Opcode{Op: "rminst", Unit: &Unit{Name: "core"}, Instance: "\\u_a.b "}, "module core;\n  BUFX2 \\U[1]  (.A(a)), U1 (.A(a));\nendmodule\n"},
+		{Opcode{Op: "rminst", Unit: &Unit{Name: "core"}, Instance: "\\U[1] "}, "module core;\n  BUFX2 \\u_a.b  (.A(a)), U1 (.A(a));\nendmodule\n"},
+	}
+	for _, c := range cases {
+		got, err := InstanceAction(sources, c.op)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got[1].Content != c.expect {
+			t.Errorf("%s: expected\n[%s]\nbut got\n[%s]", c.op.Instance, c.expect, got[1].Content)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package vtext
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zhuzhzh/vmod/internal/vlex"
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+type pIndex struct {
+	beginIndex int
+	endIndex   int
+}
+
+// block is one matched block together with the variables captured for it.
+// With regular expressions the variables hold the numbered and named groups
+// of the begin match, "0" being the whole begin match, and the named groups
+// of the end match. Design unit blocks have their "kind" and "name", "0"
+// being both.
+type block struct {
+	pIndex
+	vars map[string]string
+}
+
+// endAliases lists the other words closing a block opened for endword.
+var endAliases = map[string][]string{
+	"join": {"join_any", "join_none"},
+}
+
+// findBlocks returns the blocks of text selected by the opcode.
+func findBlocks(text string, op Opcode) ([]block, error) {
+	if op.Unit != nil {
+		return findUnitBlocks(text, *op.Unit)
+	}
+	if op.BeginRe != "" || op.EndRe != "" {
+		return findRegexBlocks(text, op)
+	}
+	if op.Begin == "" || op.End == "" {
+		return nil, errors.New("missing begin or end word")
+	}
+
+	var occurs []pIndex
+	if op.Nested {
+		occurs = findNestedBeginEnd(text, op.Begin, op.End)
+	} else {
+		occurs = findAllBeginEnd(text, op.Begin, op.End)
+	}
+	res := make([]block, len(occurs))
+	for i, p := range occurs {
+		res[i] = block{pIndex: p}
+	}
+	return res, nil
+}
+
+// findAllBeginEnd searches for pairs of beginword and endword in the text.
+// Both words are compared token by token, so they only match whole
+// identifiers and keywords, and never inside comments, string literals or
+// attributes. endword should be the first one following beginword tightly.
+func findAllBeginEnd(text, beginword, endword string) []pIndex {
+	var res []pIndex
+	bw, ew := words(beginword), words(endword)
+	if len(bw) == 0 || len(ew) == 0 {
+		return nil
+	}
+	toks := vlex.Significant(vlex.Lex(text))
+	for i := 0; i < len(toks); i++ {
+		if !matchWords(toks, i, bw) {
+			continue
+		}
+		log.Debugf("Found beginword at index %d", toks[i].Pos)
+		j := i + len(bw)
+		for j < len(toks) && !matchWords(toks, j, ew) {
+			j++
+		}
+		if j == len(toks) {
+			break
+		}
+		log.Debugf("Found endword at index %d", toks[j].Pos)
+		res = append(res, pIndex{toks[i].Pos, toks[j+len(ew)-1].End()})
+		i = j + len(ew) - 1
+	}
+	return res
+}
+
+// words splits a begin or end word into the text of its tokens.
+func words(word string) []string {
+	var res []string
+	for _, t := range vlex.Significant(vlex.Lex(word)) {
+		res = append(res, t.Text)
+	}
+	return res
+}
+
+// matchWords reports whether the tokens starting at toks[i] spell words.
+func matchWords(toks []vlex.Token, i int, words []string) bool {
+	if i+len(words) > len(toks) {
+		return false
+	}
+	for k, w := range words {
+		if toks[i+k].Text != w {
+			return false
+		}
+	}
+	return true
+}
+
+// findNestedBeginEnd is like findAllBeginEnd but pairs each beginword with
+// its balanced endword. Every further occurrence of the first token of
+// beginword opens a nested block which must be closed before the outer one,
+// so "begin"/"end" or "fork"/"join" stop at the matching end and not at the
+// first inner one. A single endword also matches its aliases, e.g. "join"
+// closes on join_any and join_none as well.
+func findNestedBeginEnd(text, beginword, endword string) []pIndex {
+	var res []pIndex
+	bw, ew := words(beginword), words(endword)
+	if len(bw) == 0 || len(ew) == 0 {
+		return nil
+	}
+	ends := [][]string{ew}
+	if len(ew) == 1 {
+		for _, alias := range endAliases[ew[0]] {
+			ends = append(ends, []string{alias})
+		}
+	}
+	toks := vlex.Significant(vlex.Lex(text))
+	for i := 0; i < len(toks); i++ {
+		if !matchWords(toks, i, bw) {
+			continue
+		}
+		log.Debugf("Found beginword at index %d", toks[i].Pos)
+		depth := 1
+		j := i + len(bw)
+		for j < len(toks) {
+			n := matchAnyWords(toks, j, ends)
+			if n == 0 {
+				if isOpener(toks, j, bw[0]) {
+					depth++
+				}
+				j++
+				continue
+			}
+			j += n
+			if depth--; depth == 0 {
+				break
+			}
+		}
+		if depth > 0 {
+			log.WithFields(log.Fields{
+				"begin":      beginword,
+				"end":        endword,
+				"beginIndex": toks[i].Pos,
+			}).Error("can't find the balanced end")
+			break
+		}
+		log.Debugf("Found endword ending at index %d", toks[j-1].End())
+		res = append(res, pIndex{toks[i].Pos, toks[j-1].End()})
+		i = j - 1
+	}
+	return res
+}
+
+// matchAnyWords returns the number of tokens matched by the first of the
+// alternatives found at toks[i], or 0.
+func matchAnyWords(toks []vlex.Token, i int, alternatives [][]string) int {
+	for _, words := range alternatives {
+		if matchWords(toks, i, words) {
+			return len(words)
+		}
+	}
+	return 0
+}
+
+// isOpener reports whether toks[i] opens a nested block. "wait fork" and
+// "disable fork" are statements, not blocks.
+func isOpener(toks []vlex.Token, i int, head string) bool {
+	if toks[i].Text != head {
+		return false
+	}
+	if head == "fork" && i > 0 && (toks[i-1].Text == "wait" || toks[i-1].Text == "disable") {
+		return false
+	}
+	return true
+}
+
+// findRegexBlocks searches for the blocks starting with a match of the begin
+// regular expression and ending with a match of the end one. The regular
+// expressions run on the text with comments, strings and attributes blanked
+// out. A literal begin or end word may stand in for a missing expression.
+func findRegexBlocks(text string, op Opcode) ([]block, error) {
+	bre, err := compileWordRe(op.BeginRe, op.Begin)
+	if err != nil {
+		return nil, err
+	}
+	ere, err := compileWordRe(op.EndRe, op.End)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []block
+	masked := vlex.Blank(text)
+	begins := bre.FindAllStringSubmatchIndex(masked, -1)
+	ends := ere.FindAllStringSubmatchIndex(masked, -1)
+	pos, e := 0, 0
+	for bi, b := range begins {
+		if b[0] < pos || b[1] == b[0] {
+			continue
+		}
+		for e < len(ends) && ends[e][0] < b[1] {
+			e++
+		}
+		depth, next := 1, bi+1
+		end := -1
+		for k := e; k < len(ends); k++ {
+			if op.Nested {
+				for next < len(begins) && begins[next][0] < ends[k][0] {
+					if begins[next][0] >= b[1] && begins[next][1] > begins[next][0] {
+						depth++
+					}
+					next++
+				}
+			}
+			if depth--; depth == 0 {
+				end = k
+				break
+			}
+		}
+		if end < 0 {
+			log.WithFields(log.Fields{
+				"begin":      bre.String(),
+				"end":        ere.String(),
+				"beginIndex": b[0],
+			}).Error("can't find the end")
+			break
+		}
+		vars := map[string]string{}
+		addCaptures(vars, text, bre, b, true)
+		addCaptures(vars, text, ere, ends[end], false)
+		res = append(res, block{pIndex{b[0], ends[end][1]}, vars})
+		pos = ends[end][1]
+		e = end + 1
+	}
+	return res, nil
+}
+
+// compileWordRe compiles expr, or a regular expression matching the literal
+// word when expr is empty.
+func compileWordRe(expr string, word string) (*regexp.Regexp, error) {
+	if expr != "" {
+		return regexp.Compile(expr)
+	}
+	ws := words(word)
+	if len(ws) == 0 {
+		return nil, errors.New("missing regular expression")
+	}
+	quoted := make([]string, len(ws))
+	for i, w := range ws {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	expr = strings.Join(quoted, `\s*`)
+	if isWordByte(ws[0][0]) {
+		expr = `\b` + expr
+	}
+	if last := ws[len(ws)-1]; isWordByte(last[len(last)-1]) {
+		expr += `\b`
+	}
+	return regexp.Compile(expr)
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// addCaptures stores the groups of the match loc into vars. The numbered
+// groups are only stored when numbered is set.
+func addCaptures(vars map[string]string, text string, re *regexp.Regexp, loc []int, numbered bool) {
+	for i, name := range re.SubexpNames() {
+		if loc[2*i] < 0 {
+			continue
+		}
+		value := text[loc[2*i]:loc[2*i+1]]
+		if numbered {
+			vars[strconv.Itoa(i)] = value
+		}
+		if name != "" {
+			vars[name] = value
+		}
+	}
+}
+
+// findUnitBlocks returns the declarations of the design units selected by
+// sel, from the declaration keyword to the end keyword.
+func findUnitBlocks(text string, sel Unit) ([]block, error) {
+	if _, err := path.Match(sel.Name, ""); err != nil {
+		return nil, err
+	}
+	f, err := vparse.Parse(text)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err,
+		}).Warn("Error parsing the design units")
+	}
+
+	var res []block
+	for _, u := range f.Units {
+		if !sel.Match(u) {
+			continue
+		}
+		log.Debugf("Found %s %s at index %d", u.Kind, u.Name, u.Span.Start)
+		res = append(res, block{
+			pIndex: pIndex{u.Span.Start, u.Span.End},
+			vars: map[string]string{
+				"0":    u.Kind + " " + u.Name,
+				"kind": u.Kind,
+				"name": u.Name,
+			},
+		})
+	}
+	return res, nil
+}
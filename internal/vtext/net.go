@@ -0,0 +1,150 @@
+package vtext
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zhuzhzh/vmod/internal/vlex"
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+// RenameNetAction renames the net op.From to op.To in the design units
+// selected by op.Unit: its declaration, the expressions using it and the
+// connections of instance pins to it. Port names of connections, member and
+// package references, comments and strings are left alone. Ports cannot be
+// renamed since it would change the interface of the unit, nor the nets of
+// units connecting instances with .*, which may connect them implicitly.
+func RenameNetAction(fileContent string, op Opcode) (string, error) {
+	log.WithFields(log.Fields{
+		"unit": op.Unit,
+		"from": op.From,
+		"to":   op.To,
+	}).Debug("Renaming net")
+
+	if op.Unit == nil || op.From == "" || op.To == "" {
+		return "", fmt.Errorf("missing unit, from or to")
+	}
+	f := parseSource(fileContent, op.File)
+	var edits []edit
+	for _, u := range f.Units {
+		if !op.Unit.Match(u) {
+			continue
+		}
+		e, err := renameNetEdits(fileContent, u, op.From, op.To)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", u.Name, err)
+		}
+		edits = append(edits, e...)
+	}
+	return applyEdits(fileContent, edits), nil
+}
+
+// renameNetEdits returns the edits renaming the net from to to in the unit u
+// of src.
+func renameNetEdits(src string, u *vparse.Unit, from string, to string) ([]edit, error) {
+	if u.Port(from) != nil {
+		return nil, fmt.Errorf("%s is a port", from)
+	}
+	if u.Port(to) != nil || declares(u, to) || u.Instance(to) != nil {
+		return nil, fmt.Errorf("%s is already declared", to)
+	}
+
+	// the names of the units and instances are not nets
+	skip := map[int]bool{u.NameSpan.Start: true}
+	implicit := map[int]*vparse.Conn{}
+	for _, inst := range u.Instances {
+		skip[inst.MasterSpan.Start] = true
+		skip[inst.NameSpan.Start] = true
+		for _, c := range inst.Conns {
+			if c.Name == "*" {
+				// renaming the net would disconnect the pin of the same name
+				return nil, fmt.Errorf("instance %s connects its pins with .*, which may use %s", inst.Name, from)
+			}
+			if c.Implicit && c.Name == from {
+				implicit[c.Span.Start] = c
+			}
+		}
+	}
+
+	var edits []edit
+	name := identText(to)
+	toks := vlex.Lex(u.Span.Text(src))
+	var prev vlex.Token
+	for _, tok := range toks {
+		pos := u.Span.Start + tok.Pos
+		if c, ok := implicit[pos]; ok {
+			// ".net" connects the pin to the net of the same name
+			edits = append(edits, edit{c.Span, "." + identText(c.Name) + "(" + name + ")"})
+		}
+		if tok.IsTrivia() {
+			continue
+		}
+		if tok.IsIdent() && tok.Name() == from && !skip[pos] && !prev.Is(".") && !prev.Is("::") {
+			edits = append(edits, edit{vparse.Span{Start: pos, End: pos + len(tok.Text)}, name})
+		}
+		prev = tok
+	}
+	return edits, nil
+}
+
+// declares reports whether u declares name in its body.
+func declares(u *vparse.Unit, name string) bool {
+	for _, d := range u.Decls {
+		for _, v := range d.Vars {
+			if v.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReconnectAction connects the pin op.Port of the instances selected by
+// op.Unit and op.Instance, as for the instance operations, to the net op.Net.
+// Instances connected by position are reported and left as they are.
+func ReconnectAction(sources []Source, op Opcode) ([]Source, error) {
+	log.WithFields(log.Fields{
+		"unit":     op.Unit,
+		"instance": op.Instance,
+		"port":     op.Port,
+		"net":      op.Net,
+	}).Debug("Reconnecting instance pin")
+
+	if op.Instance == "" || op.Port == "" {
+		return nil, fmt.Errorf("missing instance or port")
+	}
+	files := make([]*vparse.File, len(sources))
+	for i, src := range sources {
+		files[i] = parseSource(src.Content, src.File)
+	}
+	selected, err := selectInstances(files, op)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := "." + identText(op.Port) + "(" + op.Net + ")"
+	edits := make([][]edit, len(sources))
+	for i, f := range files {
+		for _, u := range f.Units {
+			for _, inst := range u.Instances {
+				if !selected[inst] {
+					continue
+				}
+				if len(inst.Conns) > 0 && !inst.Conns[0].Named() {
+					log.WithFields(log.Fields{
+						"file":     sources[i].File,
+						"unit":     u.Name,
+						"instance": inst.Name,
+					}).Warn("The instance is connected by position and is not rewritten")
+					continue
+				}
+				if c := connByName(inst, op.Port); c != nil {
+					edits[i] = append(edits[i], edit{c.Span, conn})
+				} else {
+					edits[i] = append(edits[i], appendItem(sources[i].Content, inst.ConnList, conn))
+				}
+			}
+		}
+	}
+	return applySourceEdits(sources, edits), nil
+}
@@ -0,0 +1,60 @@
+package vtext
+
+import (
+	"testing"
+)
+
+func TestRenameNetAction(t *testing.T) {
+	text := `module core (input a, output z);
+  wire n1, n1_x;
+  assign n1 = a & pkg::n1; // n1 is the and
+  BUFX2 U1 (.A(n1), .Y(z)), n1_buf (.A(n1_x), .Y());
+  sub u_sub (.n1, .b(s.n1), .c({n1, a}));
+  initial $display("n1");
+endmodule
+module other; wire n1; endmodule
+`
+	got, err := RenameNetAction(text, Opcode{Unit: &Unit{Name: "core"}, From: "n1", To: "eco_n1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `module core (input a, output z);
+  wire eco_n1, n1_x;
+  assign eco_n1 = a & pkg::n1; // n1 is the and
+  BUFX2 U1 (.A(eco_n1), .Y(z)), n1_buf (.A(n1_x), .Y());
+  sub u_sub (.n1(eco_n1), .b(s.n1), .c({eco_n1, a}));
+  initial $display("n1");
+endmodule
+module other; wire n1; endmodule
+`
+	if got != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got)
+	}
+
+	for _, op := range []Opcode{
+		{Unit: &Unit{Name: "core"}, From: "a", To: "b"},
+		{Unit: &Unit{Name: "core"}, From: "n1", To: "n1_x"},
+	} {
+		if _, err := RenameNetAction(text, op); err == nil {
+			t.Errorf("%s to %s: expected an error", op.From, op.To)
+		}
+	}
+	wildcard := "module core (input a);\n  wire n1;\n  sub u_sub (.*);\nendmodule\n"
+	if _, err := RenameNetAction(wildcard, Opcode{Unit: &Unit{Name: "core"}, From: "n1", To: "eco_n1"}); err == nil {
+		t.Errorf("Expected an error for the .* connections")
+	}
+}
+
+func TestReconnectAction(t *testing.T) {
+	sources := []Source{
+		{"core.v", "module core (input a, output z);\n  BUFX2 U1 (.A(a), .Y(z)), U2 (.A(a));\n  INVX1 U3 (a, z);\nendmodule\n"},
+	}
+	got, err := ReconnectAction(sources, Opcode{Unit: &Unit{Name: "core"}, Instance: "U*", Port: "Y", Net: "eco_net"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "module core (input a, output z);\n  BUFX2 U1 (.A(a), .Y(eco_net)), U2 (.A(a), .Y(eco_net));\n  INVX1 U3 (a, z);\nendmodule\n"
+	if got[0].Content != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got[0].Content)
+	}
+}
@@ -0,0 +1,83 @@
+package vtext
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+// SetParamAction sets the default value of the parameter op.Param of the
+// design units selected by op.Unit to op.Value. With op.Overrides, the named
+// overrides of the parameter at the instances of the units in the file set
+// are set too; positional overrides are reported and left as they are.
+func SetParamAction(sources []Source, op Opcode) ([]Source, error) {
+	log.WithFields(log.Fields{
+		"unit":      op.Unit,
+		"param":     op.Param,
+		"value":     op.Value,
+		"overrides": op.Overrides,
+	}).Debug("Setting parameter")
+
+	if op.Unit == nil || op.Param == "" || op.Value == "" {
+		return nil, fmt.Errorf("missing unit, param or value")
+	}
+
+	files, units := selectUnits(sources, *op.Unit)
+	masters := map[string]bool{}
+	edits := make([][]edit, len(sources))
+	for i, f := range files {
+		for _, u := range f.Units {
+			param := u.Param(op.Param)
+			if !units[u] || param == nil {
+				continue
+			}
+			masters[u.Name] = true
+			if param.ValueSpan.Empty() {
+				log.WithFields(log.Fields{
+					"file":  sources[i].File,
+					"unit":  u.Name,
+					"param": op.Param,
+				}).Warn("The parameter has no default value to set")
+				continue
+			}
+			edits[i] = append(edits[i], edit{param.ValueSpan, op.Value})
+		}
+	}
+
+	if op.Overrides {
+		for i, f := range files {
+			edits[i] = append(edits[i], overrideEdits(sources[i].File, f, masters, op)...)
+		}
+	}
+	return applySourceEdits(sources, edits), nil
+}
+
+// overrideEdits returns the edits setting the named overrides of op.Param at
+// the instances of the masters in f.
+func overrideEdits(file string, f *vparse.File, masters map[string]bool, op Opcode) []edit {
+	var edits []edit
+	for _, u := range f.Units {
+		for k, inst := range u.Instances {
+			// the instances of one statement share the overrides
+			if !masters[inst.Master] || k > 0 && inst.Stmt == u.Instances[k-1].Stmt {
+				continue
+			}
+			if len(inst.Params) > 0 && !inst.Params[0].Named() {
+				log.WithFields(log.Fields{
+					"file":     file,
+					"unit":     u.Name,
+					"instance": inst.Name,
+					"master":   inst.Master,
+				}).Warn("The parameters of the instance are overridden by position and are not rewritten")
+				continue
+			}
+			for _, c := range inst.Params {
+				if c.Name == op.Param {
+					edits = append(edits, edit{c.Span, "." + op.Param + "(" + op.Value + ")"})
+				}
+			}
+		}
+	}
+	return edits
+}
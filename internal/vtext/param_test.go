@@ -0,0 +1,31 @@
+package vtext
+
+import (
+	"testing"
+)
+
+func TestSetParamAction(t *testing.T) {
+	sources := []Source{
+		{"fifo.v", "module fifo #(parameter WIDTH = 8, DEPTH = 4) (input [WIDTH-1:0] d);\nendmodule\n" +
+			"module old (d);\n  parameter WIDTH = 8;\n  input [WIDTH-1:0] d;\nendmodule\n"},
+		{"top.v", "module top;\n  fifo #(.DEPTH(2), .WIDTH(16)) u0 (.d(x)), u1 (.d(y));\n  fifo #(16) u2 (.d(x));\n  fifo u3 (.d(x));\n  old #(.WIDTH()) u4 (x);\nendmodule\n"},
+	}
+	got, err := SetParamAction(sources, Opcode{Unit: &Unit{Name: "*"}, Param: "WIDTH", Value: "32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "module fifo #(parameter WIDTH = 32, DEPTH = 4) (input [WIDTH-1:0] d);\nendmodule\n" +
+		"module old (d);\n  parameter WIDTH = 32;\n  input [WIDTH-1:0] d;\nendmodule\n"
+	if got[0].Content != expect || got[1].Content != sources[1].Content {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]\n[%s]", expect, got[0].Content, got[1].Content)
+	}
+
+	got, err = SetParamAction(sources, Opcode{Unit: &Unit{Name: "*"}, Param: "WIDTH", Value: "32", Overrides: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect = "module top;\n  fifo #(.DEPTH(2), .WIDTH(32)) u0 (.d(x)), u1 (.d(y));\n  fifo #(16) u2 (.d(x));\n  fifo u3 (.d(x));\n  old #(.WIDTH(32)) u4 (x);\nendmodule\n"
+	if got[1].Content != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got[1].Content)
+	}
+}
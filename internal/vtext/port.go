@@ -0,0 +1,489 @@
+package vtext
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zhuzhzh/vmod/internal/vlex"
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+// AddPortAction adds the port op.Port to the design units selected by op.Unit
+// and, when op.Net is given, connects it to op.Net at every instance of them
+// in the file set.
+func AddPortAction(sources []Source, op Opcode) ([]Source, error) {
+	log.WithFields(log.Fields{
+		"unit":  op.Unit,
+		"port":  op.Port,
+		"dir":   op.Dir,
+		"range": op.Range,
+		"net":   op.Net,
+	}).Debug("Adding port")
+
+	if op.Unit == nil || op.Port == "" {
+		return nil, fmt.Errorf("missing unit or port")
+	}
+	dir := op.Dir
+	if dir == "" {
+		dir = "input"
+	}
+	if !portDirs[dir] {
+		return nil, fmt.Errorf("unknown port direction %q, expect input, output or inout", dir)
+	}
+	decl := dir
+	if r := portRange(op.Range); r != "" {
+		decl += " " + r
+	}
+	decl += " " + identText(op.Port)
+
+	files, units := selectUnits(sources, *op.Unit)
+	masters := map[string]bool{}
+	edits := make([][]edit, len(sources))
+	for i, f := range files {
+		for _, u := range f.Units {
+			if !units[u] {
+				continue
+			}
+			if u.Port(op.Port) != nil {
+				log.WithFields(log.Fields{
+					"file": sources[i].File,
+					"unit": u.Name,
+					"port": op.Port,
+				}).Warn("The port already exists, the unit and its instances are left as they are")
+				continue
+			}
+			masters[u.Name] = true
+			edits[i] = append(edits[i], addPortEdits(sources[i].Content, u, decl)...)
+		}
+	}
+
+	if op.Net != "" {
+		conn := "." + identText(op.Port) + "(" + op.Net + ")"
+		for i, f := range files {
+			for _, u := range f.Units {
+				for _, inst := range u.Instances {
+					if !masters[inst.Master] || connByName(inst, op.Port) != nil {
+						continue
+					}
+					item := conn
+					if len(inst.Conns) > 0 && !inst.Conns[0].Named() {
+						item = op.Net
+					}
+					edits[i] = append(edits[i], appendItem(sources[i].Content, inst.ConnList, item))
+				}
+			}
+		}
+	}
+
+	return applySourceEdits(sources, edits), nil
+}
+
+var portDirs = map[string]bool{"input": true, "output": true, "inout": true}
+
+// portRange returns the packed range r between brackets.
+func portRange(r string) string {
+	r = strings.TrimSpace(r)
+	if r != "" && !strings.HasPrefix(r, "[") {
+		r = "[" + r + "]"
+	}
+	return r
+}
+
+// selectUnits parses the sources and returns their files with the units
+// matching sel.
+func selectUnits(sources []Source, sel Unit) ([]*vparse.File, map[*vparse.Unit]bool) {
+	files := make([]*vparse.File, len(sources))
+	units := map[*vparse.Unit]bool{}
+	for i, src := range sources {
+		files[i] = parseSource(src.Content, src.File)
+		for _, u := range files[i].Units {
+			if sel.Match(u) {
+				units[u] = true
+			}
+		}
+	}
+	return files, units
+}
+
+// addPortEdits returns the edits adding the port declared by decl, e.g.
+// "input [3:0] scan_en", to the unit u of src.
+func addPortEdits(src string, u *vparse.Unit, decl string) []edit {
+	name := decl[strings.LastIndexByte(decl, ' ')+1:]
+	switch {
+	case u.PortList.Empty():
+		// no port list at all, add one before the semicolon of the header
+		pos := u.Header.End - 1
+		return []edit{{vparse.Span{Start: pos, End: pos}, " (" + decl + ")"}}
+	case u.ANSI || len(u.Ports) == 0:
+		return []edit{appendItem(src, u.PortList, decl)}
+	}
+
+	edits := []edit{appendItem(src, u.PortList, name)}
+	pos, indent := u.Header.End, "  "
+	for _, port := range u.Ports {
+		if port.Decl != nil && port.Decl.Span.End > pos {
+			pos = port.Decl.Span.End
+			indent = lineIndent(src, port.Decl.Span.Start)
+		}
+	}
+	return append(edits, insertLines(src, pos, indent+decl+";"))
+}
+
+// removePortEdits returns the edits removing port from the unit u of src and
+// declaring it as a local net instead, driven by tie if it is an input.
+func removePortEdits(src string, u *vparse.Unit, port *vparse.Port, tie string) []edit {
+	items := make([]vparse.Span, len(u.Ports))
+	k := 0
+	for i, p := range u.Ports {
+		items[i] = p.Span
+		if p == port {
+			k = i
+		}
+	}
+	edits := removeItem(src, items, k)
+	name := identText(port.Name)
+	// the declaration and the tie-off are inserted at once when only blanks
+	// separate them, as the two insertions would rewrite the same blanks
+	var inserts []insertion
+
+	switch {
+	case u.ANSI:
+		// the next port inherits the declaration of the removed one
+		if next := k + 1; next < len(u.Ports) && u.Ports[next].Inherited && !port.Inherited {
+			edits = append(edits, edit{u.Ports[next].Span, u.Ports[next].DeclText()})
+		}
+		if !strings.Contains(port.Type, ".") {
+			inserts = append(inserts, insertion{u.Header.End, "  " + localDecl(port)})
+		}
+	case port.Decl != nil:
+		d := port.Decl
+		switch {
+		case len(d.Vars) > 1:
+			vars := make([]vparse.Span, len(d.Vars))
+			j := 0
+			for i, v := range d.Vars {
+				vars[i] = v.Span
+				if v.Name == port.Name {
+					j = i
+				}
+			}
+			edits = append(edits, removeItem(src, vars, j)...)
+			if !hasNetDecl(u, port.Name) {
+				inserts = append(inserts, insertion{d.Span.End, lineIndent(src, d.Span.Start) + localDecl(port)})
+			}
+		case hasNetDecl(u, port.Name):
+			edits = append(edits, deleteLine(src, d.Span))
+		case d.Type != "":
+			// "output reg q;" becomes "reg q;"
+			edits = append(edits, edit{vparse.Span{Start: d.Span.Start, End: spaceAfter(src, d.Span.Start+len(d.Kind))}, ""})
+		default:
+			edits = append(edits, edit{vparse.Span{Start: d.Span.Start, End: d.Span.Start + len(d.Kind)}, "wire"})
+		}
+	}
+
+	if port.Dir == "input" && tie != "" {
+		inserts = append(inserts, insertion{u.EndSpan.Start, "  assign " + name + " = " + tieValues[tie] + ";"})
+	}
+	return append(edits, insertAll(src, inserts)...)
+}
+
+// insertion is a text inserted as whole lines at pos.
+type insertion struct {
+	pos  int
+	text string
+}
+
+// insertAll returns the edits inserting the lines of inserts, which are ordered
+// by position. The insertions only separated by blanks are merged, so their
+// edits do not overlap.
+func insertAll(src string, inserts []insertion) []edit {
+	var edits []edit
+	for i := 0; i < len(inserts); i++ {
+		ins := inserts[i]
+		for i+1 < len(inserts) && strings.TrimSpace(src[ins.pos:inserts[i+1].pos]) == "" {
+			i++
+			ins.text += "\n" + inserts[i].text
+		}
+		edits = append(edits, insertLines(src, ins.pos, ins.text))
+	}
+	return edits
+}
+
+// localDecl returns the declaration of port as a local net or variable.
+func localDecl(port *vparse.Port) string {
+	fields := []string{port.Type}
+	if port.Type == "" {
+		fields[0] = "wire"
+	}
+	if port.Signed {
+		fields = append(fields, "signed")
+	}
+	if port.Range != "" {
+		fields = append(fields, port.Range)
+	}
+	return strings.Join(append(fields, identText(port.Name)), " ") + ";"
+}
+
+// hasNetDecl reports whether u declares name as a net or variable besides its
+// port declaration.
+func hasNetDecl(u *vparse.Unit, name string) bool {
+	for _, d := range u.Decls {
+		if portDirs[d.Kind] || d.Kind == "parameter" || d.Kind == "localparam" {
+			continue
+		}
+		for _, v := range d.Vars {
+			if v.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeItem returns the edits removing items[i] from its comma separated
+// list of src, together with the comma separating it from its neighbor. The
+// comments between them are kept, and so on their line.
+func removeItem(src string, items []vparse.Span, i int) []edit {
+	if len(items) == 1 {
+		return []edit{{items[0], ""}}
+	}
+	// the neighbor is the previous item, or the next one for the first
+	prev, next := i-1, i
+	if i == 0 {
+		prev, next = 0, 1
+	}
+	between := vparse.Span{Start: items[prev].End, End: items[next].Start}
+	comma := -1
+	hasComment := false
+	for _, tok := range vlex.Lex(between.Text(src)) {
+		if tok.Is(",") && comma < 0 {
+			comma = between.Start + tok.Pos
+		}
+		hasComment = hasComment || tok.Kind == vlex.Comment
+	}
+	switch {
+	case !hasComment && i > 0:
+		return []edit{{vparse.Span{Start: items[i-1].End, End: items[i].End}, ""}}
+	case !hasComment:
+		return []edit{{vparse.Span{Start: items[0].Start, End: items[1].Start}, ""}}
+	case comma < 0:
+		return []edit{{items[i], ""}}
+	}
+	item := items[i]
+	if i == 0 {
+		// "a, // c" becomes "// c"
+		return []edit{{item, ""}, {vparse.Span{Start: comma, End: spaceAfter(src, comma+1)}, ""}}
+	}
+	if strings.TrimSpace(src[strings.LastIndexByte(src[:item.Start], '\n')+1:item.Start]) == "" {
+		item.End = spaceAfter(src, item.End)
+	}
+	return []edit{{vparse.Span{Start: comma, End: comma + 1}, ""}, {item, ""}}
+}
+
+// deleteLine returns the edit deleting the span, with its whole line when
+// nothing else is on it.
+func deleteLine(src string, span vparse.Span) edit {
+	start := strings.LastIndexByte(src[:span.Start], '\n') + 1
+	end := strings.IndexByte(src[span.End:], '\n')
+	if end < 0 {
+		end = len(src)
+	} else {
+		end += span.End + 1
+	}
+	if strings.TrimSpace(src[start:span.Start]) != "" || strings.TrimSpace(src[span.End:end]) != "" {
+		return edit{span, ""}
+	}
+	return edit{vparse.Span{Start: start, End: end}, ""}
+}
+
+// spaceAfter returns the end of the blanks following pos.
+func spaceAfter(src string, pos int) int {
+	for pos < len(src) && (src[pos] == ' ' || src[pos] == '\t') {
+		pos++
+	}
+	return pos
+}
+
+// appendItem returns the edit appending item to the parenthesized comma
+// separated list of src. Lists spanning several lines get the item on a line
+// of its own, indented like the last item, after the comment following the
+// last item on its line.
+func appendItem(src string, list vparse.Span, item string) edit {
+	toks := vlex.Significant(vlex.Lex(list.Text(src)))
+	if len(toks) <= 2 {
+		pos := list.Start + 1
+		return edit{vparse.Span{Start: pos, End: pos}, item}
+	}
+	last := toks[len(toks)-2]
+	pos := list.Start + last.End()
+	if !strings.Contains(src[list.Start:pos], "\n") {
+		return edit{vparse.Span{Start: pos, End: pos}, ", " + item}
+	}
+	line := src[strings.LastIndexByte(src[:pos], '\n')+1 : pos]
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	if end := trailingComment(src, pos); end > pos {
+		return edit{vparse.Span{Start: pos, End: end}, "," + src[pos:end] + "\n" + indent + item}
+	}
+	return edit{vparse.Span{Start: pos, End: pos}, ",\n" + indent + item}
+}
+
+// trailingComment returns the end of the comments ending the line of src
+// after pos, or pos when something else follows on the line.
+func trailingComment(src string, pos int) int {
+	end := strings.IndexByte(src[pos:], '\n')
+	if end < 0 {
+		end = len(src) - pos
+	}
+	comment := false
+	for _, tok := range vlex.Lex(src[pos : pos+end]) {
+		if !tok.IsTrivia() {
+			return pos
+		}
+		comment = comment || tok.Kind == vlex.Comment
+	}
+	if !comment {
+		return pos
+	}
+	return pos + len(strings.TrimRight(src[pos:pos+end], " \t\r"))
+}
+
+// connByName returns the named connection of the port of inst, or nil.
+func connByName(inst *vparse.Instance, port string) *vparse.Conn {
+	for _, c := range inst.Conns {
+		if c.Name == port {
+			return c
+		}
+	}
+	return nil
+}
+
+// RemovePortAction removes the port op.Port from the design units selected by
+// op.Unit and its named connections from their instances in the file set.
+// Inside the units the port becomes a local net, driven by op.Tie for inputs.
+// Instances connected by position are reported and left as they are.
+func RemovePortAction(sources []Source, op Opcode) ([]Source, error) {
+	log.WithFields(log.Fields{
+		"unit": op.Unit,
+		"port": op.Port,
+		"tie":  op.Tie,
+	}).Debug("Removing port")
+
+	if op.Unit == nil || op.Port == "" {
+		return nil, fmt.Errorf("missing unit or port")
+	}
+	if _, ok := tieValues[op.Tie]; !ok && op.Tie != "" {
+		return nil, fmt.Errorf("unknown tie mode %q, expect zero, one, x or z", op.Tie)
+	}
+
+	files, units := selectUnits(sources, *op.Unit)
+	masters := map[string]bool{}
+	edits := make([][]edit, len(sources))
+	for i, f := range files {
+		for _, u := range f.Units {
+			port := u.Port(op.Port)
+			if !units[u] || port == nil {
+				continue
+			}
+			masters[u.Name] = true
+			edits[i] = append(edits[i], removePortEdits(sources[i].Content, u, port, op.Tie)...)
+		}
+	}
+
+	for i, f := range files {
+		forInstances(sources[i].File, f, masters, func(inst *vparse.Instance) {
+			spans := make([]vparse.Span, len(inst.Conns))
+			for k, c := range inst.Conns {
+				spans[k] = c.Span
+			}
+			for k, c := range inst.Conns {
+				if c.Name == op.Port {
+					edits[i] = append(edits[i], removeItem(sources[i].Content, spans, k)...)
+				}
+			}
+		})
+	}
+	return applySourceEdits(sources, edits), nil
+}
+
+// TiePortAction keeps the port op.Port of the design units selected by
+// op.Unit and ties it at their instances in the file set: inputs to the value
+// of op.Tie, zero by default, the other ports to nothing. Instances
+// connected by position are reported and left as they are.
+func TiePortAction(sources []Source, op Opcode) ([]Source, error) {
+	log.WithFields(log.Fields{
+		"unit": op.Unit,
+		"port": op.Port,
+		"tie":  op.Tie,
+	}).Debug("Tying port")
+
+	if op.Unit == nil || op.Port == "" {
+		return nil, fmt.Errorf("missing unit or port")
+	}
+	value, ok := tieValues[op.Tie]
+	if op.Tie == "" {
+		value, ok = tieValues["zero"], true
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown tie mode %q, expect zero, one, x or z", op.Tie)
+	}
+
+	files, units := selectUnits(sources, *op.Unit)
+	dirs := map[string]string{}
+	for u := range units {
+		if port := u.Port(op.Port); port != nil {
+			dirs[u.Name] = port.Dir
+		}
+	}
+	masters := map[string]bool{}
+	for name := range dirs {
+		masters[name] = true
+	}
+
+	edits := make([][]edit, len(sources))
+	for i, f := range files {
+		forInstances(sources[i].File, f, masters, func(inst *vparse.Instance) {
+			conn := "." + identText(op.Port) + "()"
+			if dirs[inst.Master] == "input" {
+				conn = "." + identText(op.Port) + "(" + value + ")"
+			}
+			if c := connByName(inst, op.Port); c != nil {
+				edits[i] = append(edits[i], edit{c.Span, conn})
+			} else {
+				edits[i] = append(edits[i], appendItem(sources[i].Content, inst.ConnList, conn))
+			}
+		})
+	}
+	return applySourceEdits(sources, edits), nil
+}
+
+// forInstances calls fn with the instances of the masters in f connected by
+// name, and reports the ones connected by position.
+func forInstances(file string, f *vparse.File, masters map[string]bool, fn func(*vparse.Instance)) {
+	for _, u := range f.Units {
+		for _, inst := range u.Instances {
+			if !masters[inst.Master] {
+				continue
+			}
+			if len(inst.Conns) > 0 && !inst.Conns[0].Named() {
+				log.WithFields(log.Fields{
+					"file":     file,
+					"unit":     u.Name,
+					"instance": inst.Name,
+					"master":   inst.Master,
+				}).Warn("The instance is connected by position and is not rewritten")
+				continue
+			}
+			fn(inst)
+		}
+	}
+}
+
+// applySourceEdits returns the sources with their edits applied.
+func applySourceEdits(sources []Source, edits [][]edit) []Source {
+	res := make([]Source, len(sources))
+	for i, src := range sources {
+		res[i] = Source{File: src.File, Content: applyEdits(src.Content, edits[i])}
+	}
+	return res
+}
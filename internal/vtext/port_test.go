@@ -0,0 +1,179 @@
+package vtext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddPortAction(t *testing.T) {
+	sources := []Source{
+		{"cells.v", `module ansi (
+  input  a,
+  output q // result
+);
+endmodule
+module old(a, q);
+  input a;
+  output q;
+  wire n;
+endmodule
+module bare;
+endmodule
+module empty();
+endmodule
+`},
+		{"top.v", `module top;
+  ansi u0 (
+    .a(x),
+    .q(y)
+  );
+  old u1 (x, y), u2 (.a(x), .q(), .se(se));
+  bare u3 ();
+  other u4 (.a(x));
+endmodule
+`},
+	}
+	op := Opcode{Unit: &Unit{Name: "*"}, Port: "se", Range: "1:0", Net: "scan_en"}
+	got, err := AddPortAction(sources, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{`module ansi (
+  input  a,
+  output q, // result
+  input [1:0] se
+);
+endmodule
+module old(a, q, se);
+  input a;
+  output q;
+  input [1:0] se;
+  wire n;
+endmodule
+module bare (input [1:0] se);
+endmodule
+module empty(input [1:0] se);
+endmodule
+`, `module top (input [1:0] se);
+  ansi u0 (
+    .a(x),
+    .q(y),
+    .se(scan_en)
+  );
+  old u1 (x, y, scan_en), u2 (.a(x), .q(), .se(se));
+  bare u3 (.se(scan_en));
+  other u4 (.a(x));
+endmodule
+`}
+	for i, e := range expect {
+		if got[i].Content != e {
+			t.Errorf("Expected %s\n[%s]\nbut got\n[%s]", got[i].File, e, got[i].Content)
+		}
+	}
+
+	if _, err := AddPortAction(sources, Opcode{Unit: &Unit{Name: "old"}, Port: "se", Dir: "in"}); err == nil {
+		t.Errorf("Expected an error for an unknown direction")
+	}
+}
+
+func TestRemovePortAction(t *testing.T) {
+	sources := []Source{
+		{"cells.v", `module ansi (
+  input  [3:0] se, a,
+  output reg   q
+);
+endmodule
+module old(a, se, q);
+  input a, se;
+  output reg q;
+endmodule
+`},
+		{"top.v", `module top;
+  ansi u0 (.se(x), .a(x), .q(y));
+  old u1 (x, x, y), u2 (.a(x), .q(y), .se(se));
+endmodule
+`},
+	}
+	got, err := RemovePortAction(sources, Opcode{Unit: &Unit{Name: "*"}, Port: "se", Tie: "one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{`module ansi (
+  input [3:0] a,
+  output reg   q
+);
+  wire [3:0] se;
+  assign se = ~'b0;
+endmodule
+module old(a, q);
+  input a;
+  wire se;
+  output reg q;
+  assign se = ~'b0;
+endmodule
+`, `module top;
+  ansi u0 (.a(x), .q(y));
+  old u1 (x, x, y), u2 (.a(x), .q(y));
+endmodule
+`}
+	for i, e := range expect {
+		if got[i].Content != e {
+			t.Errorf("Expected %s\n[%s]\nbut got\n[%s]", got[i].File, e, got[i].Content)
+		}
+	}
+
+	got, err = RemovePortAction(sources, Opcode{Unit: &Unit{Name: "old"}, Port: "q"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := "module old(a, se);\n  input a, se;\n  reg q;\nendmodule\n"; !strings.HasSuffix(got[0].Content, e) {
+		t.Errorf("Expected the output declaration to become a variable, but got\n[%s]", got[0].Content)
+	}
+	// the comments of the ports stay on their line
+	commented := []Source{{"c.v", "module c (\n  input w, // cw\n  input x, // cx\n  output y // cy\n);\nendmodule\n"}}
+	for _, c := range []struct{ port, expect string }{
+		{"y", "module c (\n  input w, // cw\n  input x // cx\n  // cy\n);\n  wire y;\nendmodule\n"},
+		{"w", "module c (\n  // cw\n  input x, // cx\n  output y // cy\n);\n  wire w;\nendmodule\n"},
+	} {
+		got, err = RemovePortAction(commented, Opcode{Unit: &Unit{Name: "c"}, Port: c.port})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got[0].Content != c.expect {
+			t.Errorf("Expected\n[%s]\nbut got\n[%s]", c.expect, got[0].Content)
+		}
+	}
+
+	// the declaration and the tie-off go between the header and endmodule
+	one := []Source{{"a.v", "module A(input a, input b); endmodule\n"}}
+	got, err = RemovePortAction(one, Opcode{Unit: &Unit{Name: "A"}, Port: "a", Tie: "zero"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := "module A(input b);\n  wire a;\n  assign a = 'b0;\nendmodule\n"; got[0].Content != e {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", e, got[0].Content)
+	}
+}
+
+func TestTiePortAction(t *testing.T) {
+	sources := []Source{
+		{"cells.v", "module m (input se, output so);\nendmodule\n"},
+		{"top.v", "module top;\n  m u0 (.se(x), .so(y));\n  m u1 (.*);\n  m u2 (x, y);\nendmodule\n"},
+	}
+	got, err := TiePortAction(sources, Opcode{Unit: &Unit{Name: "m"}, Port: "se"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "module top;\n  m u0 (.se('b0), .so(y));\n  m u1 (.*, .se('b0));\n  m u2 (x, y);\nendmodule\n"
+	if got[0].Content != sources[0].Content || got[1].Content != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got[1].Content)
+	}
+
+	got, err = TiePortAction(sources, Opcode{Unit: &Unit{Name: "m"}, Port: "so", Tie: "z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got[1].Content, "m u0 (.se(x), .so());") {
+		t.Errorf("Expected the output to be left unconnected, but got\n[%s]", got[1].Content)
+	}
+}
@@ -4,193 +4,201 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"path"
 	"strings"
 	"sync"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/zhuzhzh/vmod/internal/helper"
+	"github.com/zhuzhzh/vmod/internal/vparse"
+	"github.com/zhuzhzh/vmod/internal/vpp"
 )
 
-type Config struct {
-	Opcode []struct {
-		Op    string `json:"op"`
-		Begin string `json:"begin"`
-		End   string `json:"end"`
-		Src   string `json:"src"`
-	} `json:"opcode"`
-}
-
-type pIndex struct {
-	beginIndex int
-	endIndex   int
+// Opcode is one operation applied on the files, either from the chain config
+// or from the command line.
+type Opcode struct {
+	Op     string `json:"op"`
+	Begin  string `json:"begin"`
+	End    string `json:"end"`
+	Src    string `json:"src"`
+	Nested bool   `json:"nested"`
+	// BeginRe and EndRe are regular expressions used instead of Begin and
+	// End. Their named groups may be referred to as ${name} in the
+	// replacement text and in Marker.
+	BeginRe string `json:"begin_re"`
+	EndRe   string `json:"end_re"`
+	// Marker is the text of the comment left in place of the blocks.
+	Marker string `json:"marker"`
+	// Unit selects whole design unit declarations instead of begin/end
+	// blocks.
+	Unit *Unit `json:"unit"`
+	// Tie drives the outputs of the dummied design units: zero, one, x, z
+	// or passthrough-by-name.
+	Tie string `json:"tie"`
+	// Blackbox lists the tool profiles (yosys, vivado, synplify, synopsys)
+	// or the literal attributes marking the dummied units as black boxes.
+	Blackbox []string `json:"blackbox"`
+	// Text is the replacement text given inline instead of the Src file.
+	Text Lines `json:"text"`
+	// SrcUnit names the design unit of the replacement text to use, and may
+	// refer to the variables of the block like ${name}. By default, the
+	// replacement of a unit selection is the unit of the same name when the
+	// replacement text declares it.
+	SrcUnit string `json:"src_unit"`
+	// CheckPorts compares the ports of the replaced design units with the
+	// replacement ones, and fails with "error" or logs with "warn" when
+	// they differ.
+	CheckPorts string `json:"check_ports"`
+	// Prefix and Suffix are added to the names of the units by uniquify.
+	Prefix string `json:"prefix"`
+	Suffix string `json:"suffix"`
+	// From and To are the old and new names of the rename and renamenet
+	// operations. To is also the new name or master of the instance
+	// operations.
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Port is the port added by addport, with its direction Dir (input by
+	// default) and packed range Range. Net is the net connected to it at
+	// the instances. Port and Net are also the pin and the net of reconnect.
+	Port  string `json:"port"`
+	Dir   string `json:"dir"`
+	Range string `json:"range"`
+	Net   string `json:"net"`
+	// Param is the parameter set to Value by setparam, and Overrides sets
+	// its overrides at the instances too.
+	Param     string `json:"param"`
+	Value     string `json:"value"`
+	Overrides bool   `json:"overrides"`
+	// Instance selects the instances of rminst, renameinst and remaster by
+	// hierarchical name, or by local name within Unit.
+	Instance string `json:"instance"`
+	// Preprocess applies the operation on the preprocessed text of the
+	// files, with the macros and include directories of PP, instead of the
+	// raw text. The files are written preprocessed.
+	Preprocess bool `json:"preprocess"`
+	// Defines, as NAME or NAME=VALUE, scopes the operation to the code
+	// active with these macros and the ones of PP: the inactive branches of
+	// the conditional directives are left as they are. With Preprocess, they
+	// are added to the macros of PP.
+	Defines []string `json:"defines"`
+	// PP is set from the defines and incdirs of the chain config.
+	PP vpp.Config `json:"-"`
+	// File is the name of the file being processed, set by OpcodeHelper.
+	File string `json:"-"`
 }
 
-type TwoParamFunc func(string, string) (string, error)
-type ThreeParamFunc func(string, string, string) (string, error)
-type FourParamFunc func(string, string, string, string) (string, error)
+// Lines is a text given in the config either as one string or as an array of
+// lines.
+type Lines string
 
-func findFirstBeginEnd(text, begin, end string) (int, int) {
-	log.WithFields(log.Fields{
-		"text":  text,
-		"begin": begin,
-		"end":   end,
-	}).Debug("Finding begin and end indices")
-
-	inBlockComment := false
-	inLineComment := false
-	for i := 0; i < len(text); i++ {
-		if !inBlockComment && !inLineComment && text[i] == '/' && i+1 < len(text) && text[i+1] == '*' {
-			inBlockComment = true
-			i++
-		} else if inBlockComment && text[i] == '*' && i+1 < len(text) && text[i+1] == '/' {
-			inBlockComment = false
-			i++
-		} else if !inBlockComment && !inLineComment && text[i] == '/' && i+1 < len(text) && text[i+1] == '/' {
-			inLineComment = true
-			i++
-		} else if inLineComment && text[i] == '\n' {
-			inLineComment = false
-		} else if !inBlockComment && !inLineComment {
-			if strings.HasPrefix(text[i:], begin) {
-				beginIndex := i
-				for j := i + len(begin); j < len(text); j++ {
-					if !inBlockComment && !inLineComment && text[j] == '/' && j+1 < len(text) && text[j+1] == '*' {
-						inBlockComment = true
-						j++
-					} else if inBlockComment && text[j] == '*' && j+1 < len(text) && text[j+1] == '/' {
-						inBlockComment = false
-						j++
-					} else if !inBlockComment && !inLineComment && text[j] == '/' && j+1 < len(text) && text[j+1] == '/' {
-						inLineComment = true
-						j++
-					} else if inLineComment && text[j] == '\n' {
-						inLineComment = false
-					} else if !inBlockComment && !inLineComment {
-						if strings.HasPrefix(text[j:], end) {
-							log.WithFields(log.Fields{
-								"text":       text,
-								"begin":      begin,
-								"end":        end,
-								"beginIndex": beginIndex,
-								"endIndex":   j + len(end),
-							}).Debug("can not find the begin")
-							return beginIndex, j + len(end)
-						}
-					}
-				}
-				log.WithFields(log.Fields{
-					"text":       text,
-					"begin":      begin,
-					"end":        end,
-					"beginIndex": beginIndex,
-				}).Error("can't find the end")
-				return beginIndex, -1
-			}
-		}
+func (l *Lines) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*l = Lines(strings.Join(lines, "\n"))
+		return nil
 	}
-	log.WithFields(log.Fields{
-		"text":  text,
-		"begin": begin,
-		"end":   end,
-	}).Error("can't find the begin")
-	return -1, -1
-}
-
-// findAllBeginEnd searches for pairs of beginword and endword in the text.
-// The function skips over line and block comments during the search.
-// endword should be the first one following beginword tightly.
-func findAllBeginEnd(text, beginword, endword string) []pIndex {
-	var res []pIndex
-	var i int
-	for i < len(text) {
-		if text[i] == '/' && i+1 < len(text) && text[i+1] == '/' {
-			log.Debug("Skipping line comment")
-			i = skipLineComment(text, i)
-		} else if text[i] == '/' && i+1 < len(text) && text[i+1] == '*' {
-			log.Debug("Skipping block comment")
-			i = skipBlockComment(text, i)
-		} else if strings.HasPrefix(text[i:], beginword) {
-			log.Debugf("Found beginword at index %d", i)
-			j := i + len(beginword)
-			for j < len(text) {
-				if text[j] == '/' && j+1 < len(text) && text[j+1] == '/' {
-					log.Debug("Skipping line comment")
-					j = skipLineComment(text, j)
-				} else if text[j] == '/' && j+1 < len(text) && text[j+1] == '*' {
-					log.Debug("Skipping block comment")
-					j = skipBlockComment(text, j)
-				} else if strings.HasPrefix(text[j:], endword) {
-					log.Debugf("Found endword at index %d", j)
-					break
-				} else {
-					j++
-				}
-			}
-			if j < len(text) && strings.HasPrefix(text[j:], endword) {
-				res = append(res, pIndex{i, j + len(endword)})
-				i = j + len(endword)
-			} else {
-				i = j
-			}
-		} else {
-			i++
-		}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("text must be a string or an array of strings: %s", data)
 	}
-	return res
+	*l = Lines(text)
+	return nil
+}
+
+// Unit selects design units by kind and name. The name may be a glob pattern
+// like "tsmc_*". An empty kind matches every kind, and "module" matches
+// macromodules too.
+type Unit struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
 }
 
-// skipLineComment skips over a line comment starting at index i in the text.
-func skipLineComment(text string, i int) int {
-	for i < len(text) && text[i] != '\n' {
-		i++
+// Match reports whether the design unit u is selected.
+func (sel Unit) Match(u *vparse.Unit) bool {
+	switch {
+	case sel.Kind == "module" && !u.IsModule():
+		return false
+	case sel.Kind != "" && sel.Kind != "module" && sel.Kind != u.Kind:
+		return false
 	}
-	return i
+	ok, _ := path.Match(sel.Name, u.Name)
+	return ok
 }
 
-// skipBlockComment skips over a block comment starting at index i in the text.
-func skipBlockComment(text string, i int) int {
-	for i < len(text)-1 && !(text[i] == '*' && text[i+1] == '/') {
-		i++
+// UnmarshalJSON accepts a unit selector object or a plain name.
+func (sel *Unit) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*sel = Unit{Name: name}
+		return nil
 	}
-	return i + 2
+	// the alias type drops the method and avoids the recursion
+	type unit Unit
+	return json.Unmarshal(data, (*unit)(sel))
+}
+
+func (sel Unit) String() string {
+	return strings.TrimSpace(sel.Kind + " " + sel.Name)
+}
+
+type Config struct {
+	Opcode []Opcode `json:"opcode"`
+	// Defines, as NAME or NAME=VALUE, and IncDirs are used by the opcodes
+	// working on the preprocessed text.
+	Defines []string `json:"defines"`
+	IncDirs []string `json:"incdirs"`
 }
 
-func removeText(input string, keyword string, p []pIndex) (output string) {
+func removeText(input string, op Opcode, p []block) (output string) {
 	var start int
 	for _, pair := range p {
 		output += input[start:pair.beginIndex]
-		output += ("// remove " + keyword + "\n")
+		output += ("// remove " + blockMarker(op, pair, op.Begin+"..."+op.End) + "\n")
 		start = pair.endIndex
 	}
 	output += input[start:]
 	return
 }
 
-func RemoveAction(fileContent string, begin string, end string) (string, error) {
+func RemoveAction(fileContent string, op Opcode) (string, error) {
 	log.WithFields(log.Fields{
-		"begin": begin,
-		"end":   end,
+		"begin":   op.Begin,
+		"end":     op.End,
+		"beginRe": op.BeginRe,
+		"endRe":   op.EndRe,
+		"nested":  op.Nested,
+		"unit":    op.Unit,
 	}).Debug("Removing content between begin and end indices")
 
-	occurs := findAllBeginEnd(fileContent, begin, end)
-	newContent := removeText(fileContent, begin+"..."+end, occurs)
+	occurs, err := findBlocks(fileContent, op)
+	if err != nil {
+		return "", err
+	}
+	newContent := removeText(fileContent, op, occurs)
 	return newContent, nil
 }
 
-func dummyText(input string, keyword string, p []pIndex) (output string) {
+func dummyText(input string, op Opcode, p []block) (output string) {
 	var start int
 	for _, pair := range p {
 		output += input[start:pair.beginIndex]
 
 		moduleContent := input[pair.beginIndex:pair.endIndex]
+		output += ("// dummy " + blockMarker(op, pair, op.Begin+"..."+op.End) + "\n")
+		if f, _ := vparse.Parse(moduleContent); len(f.Units) == 1 {
+			output += stubText(moduleContent, f.Units[0], op)
+			start = pair.endIndex
+			continue
+		}
+
+		// not a design unit, keep the lines which look like its interface
 		lines := strings.Split(moduleContent, "\n")
 		newLines := []string{}
 		for _, line := range lines {
-			if strings.Contains(line, "module") || strings.Contains(line, "endmodule") || strings.Contains(line, "input") || strings.Contains(line, "output") || strings.Contains(line, "inout") {
+			if strings.Contains(line, "module") || strings.Contains(line, "endmodule") || strings.Contains(line, "input") || strings.Contains(line, "output") || strings.Contains(line, "inout") || strings.Contains(line, "parameter") || strings.Contains(line, "localparam") {
 				newLines = append(newLines, line)
 			}
 		}
-		output += ("// dummy " + keyword + "\n")
 		output += strings.Join(newLines, "\n")
 		start = pair.endIndex
 	}
@@ -198,45 +206,126 @@ func dummyText(input string, keyword string, p []pIndex) (output string) {
 	return
 }
 
-func DummyAction(fileContent string, bw string, ew string) (string, error) {
+func DummyAction(fileContent string, op Opcode) (string, error) {
 	log.WithFields(log.Fields{
-		"begin": bw,
-		"end":   ew,
+		"begin":   op.Begin,
+		"end":     op.End,
+		"beginRe": op.BeginRe,
+		"endRe":   op.EndRe,
+		"nested":  op.Nested,
+		"unit":    op.Unit,
 	}).Debug("Dummying content between begin and end indices")
 
-	occurs := findAllBeginEnd(fileContent, bw, ew)
-	newContent := dummyText(fileContent, bw+"..."+ew, occurs)
+	if err := checkTie(op.Tie); err != nil {
+		return "", err
+	}
+	for _, profile := range op.Blackbox {
+		if _, err := blackboxText(profile); err != nil {
+			return "", err
+		}
+	}
+	occurs, err := findBlocks(fileContent, op)
+	if err != nil {
+		return "", err
+	}
+	newContent := dummyText(fileContent, op, occurs)
 	return newContent, nil
 }
 
-func replaceText(input string, repl string, keyword string, p []pIndex) (output string) {
+func replaceText(input string, repl string, op Opcode, p []block) (output string, err error) {
 	var start int
-	for _, pair := range p {
+	for i, pair := range p {
 		output += input[start:pair.beginIndex]
-		output += ("// replace " + keyword + "\n")
-		output += repl
+		output += ("// replace " + blockMarker(op, pair, op.Begin) + "\n")
+		vars := templateVars(input, op.File, i, pair)
+		text, err := unitSource(repl, op, vars)
+		if err != nil {
+			return "", err
+		}
+		text = expand(text, vars)
+		if op.CheckPorts != "" {
+			if err = checkReplacement(input[pair.beginIndex:pair.endIndex], text, op); err != nil {
+				return "", err
+			}
+		}
+		output += text
 		start = pair.endIndex
 	}
 	output += input[start:]
 	return
 }
 
-func ReplaceAction(fileContent string, replFile string, begin string, end string) (string, error) {
+func ReplaceAction(fileContent string, op Opcode) (string, error) {
 	log.WithFields(log.Fields{
-		"begin": begin,
-		"end":   end,
+		"begin":   op.Begin,
+		"end":     op.End,
+		"beginRe": op.BeginRe,
+		"endRe":   op.EndRe,
+		"nested":  op.Nested,
+		"unit":    op.Unit,
 	}).Debug("Replacing content between begin and end indices")
 
-	srcData, err := ioutil.ReadFile(replFile)
+	if op.CheckPorts != "" && op.CheckPorts != "error" && op.CheckPorts != "warn" {
+		return "", fmt.Errorf("unknown port check mode %q, expect error or warn", op.CheckPorts)
+	}
+	repl, err := replacement(op)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	occurs := findAllBeginEnd(fileContent, begin, end)
-	newContent := replaceText(fileContent, string(srcData), begin, occurs)
-	return newContent, nil
+	occurs, err := findBlocks(fileContent, op)
+	if err != nil {
+		return "", err
+	}
+	return replaceText(fileContent, repl, op, occurs)
 }
 
-func DeletelineAction(fileContent string, begin string) (string, error) {
+// unitSource returns the part of the replacement text repl used for the block
+// with the variables vars: the unit named by op.SrcUnit, or the unit named like
+// the replaced one for unit selections. The whole text is used when it
+// declares a single unit or none.
+func unitSource(repl string, op Opcode, vars map[string]string) (string, error) {
+	name := expand(op.SrcUnit, vars)
+	if name == "" && op.Unit == nil {
+		return repl, nil
+	}
+	if name == "" {
+		name = vars["name"]
+	}
+
+	f, _ := vparse.Parse(repl)
+	if u := f.Unit(name); u != nil {
+		return u.Span.Text(repl), nil
+	}
+	if op.SrcUnit != "" || len(f.Units) > 1 {
+		source := op.Src
+		if source == "" {
+			source = "the replacement text"
+		}
+		return "", fmt.Errorf("%s does not declare %s", source, name)
+	}
+	return repl, nil
+}
+
+// replacement returns the inline text of the opcode, or else the content of
+// its source file.
+func replacement(op Opcode) (string, error) {
+	switch {
+	case op.Text != "" && op.Src != "":
+		return "", fmt.Errorf("both src %s and text are given", op.Src)
+	case op.Text != "":
+		return string(op.Text), nil
+	case op.Src == "":
+		return "", fmt.Errorf("missing src or text")
+	}
+	srcData, err := ioutil.ReadFile(op.Src)
+	if err != nil {
+		return "", err
+	}
+	return string(srcData), nil
+}
+
+func DeletelineAction(fileContent string, op Opcode) (string, error) {
+	begin := op.Begin
 	log.WithFields(log.Fields{
 		"begin": begin,
 	}).Debug("deleting the line containing the key word")
@@ -253,6 +342,28 @@ func DeletelineAction(fileContent string, begin string) (string, error) {
 	return newLines, nil
 }
 
+// OpcodeAction applies one opcode on the content of one file.
+func OpcodeAction(fileContent string, op Opcode) (string, error) {
+	switch op.Op {
+	case "replace":
+		return ReplaceAction(fileContent, op)
+	case "dummy":
+		return DummyAction(fileContent, op)
+	case "remove":
+		return RemoveAction(fileContent, op)
+	case "deleteline":
+		return DeletelineAction(fileContent, op)
+	case "rename":
+		return RenameAction(fileContent, op)
+	case "renamenet":
+		return RenameNetAction(fileContent, op)
+	case "insert_before", "insert_after", "insert_at_start", "insert_at_end":
+		return InsertAction(fileContent, op)
+	default:
+		return "", fmt.Errorf("unknown opcode: %s", op.Op)
+	}
+}
+
 func readConfig(configFile string) (Config, error) {
 	configData, err := ioutil.ReadFile(configFile)
 	if err != nil {
@@ -268,105 +379,95 @@ func readConfig(configFile string) (Config, error) {
 	return config, nil
 }
 
-func ActionHelper(files []string, bw string, ew string, repl string, outDir string, funcHelper interface{}, funcDesc string) {
-	var (
-		err error
-		wg  sync.WaitGroup
-	)
-	log.WithFields(log.Fields{
-		"outDir": outDir,
-	}).Debug("Creating output directory")
+func DeleteLineHelper(files []string, kw string, outDir string) {
+	OpcodeHelper(files, []Opcode{{Op: "deleteline", Begin: kw}}, outDir)
+}
 
-	if err = helper.CreateOutputDir(outDir); err != nil {
-		log.WithFields(log.Fields{
-			"outDir": outDir,
-			"error":  err,
-		}).Error("Error creating output directory")
-		return
+func RenameHelper(files []string, from string, to string, outDir string) {
+	OpcodeHelper(files, []Opcode{{Op: "rename", From: from, To: to}}, outDir)
+}
+
+func UniquifyHelper(files []string, prefix string, suffix string, outDir string) {
+	OpcodeHelper(files, []Opcode{{Op: "uniquify", Prefix: prefix, Suffix: suffix}}, outDir)
+}
+
+// insertOps maps the positions of the insert command to the operations.
+var insertOps = map[string]string{
+	"before": "insert_before",
+	"after":  "insert_after",
+	"start":  "insert_at_start",
+	"end":    "insert_at_end",
+}
+
+// InsertHelper inserts the text of the opcodes at the position given by at:
+// before, after, start or end.
+func InsertHelper(files []string, ops []Opcode, at string, outDir string) error {
+	name, ok := insertOps[at]
+	if !ok {
+		return fmt.Errorf("unknown insert position %q, expect before, after, start or end", at)
 	}
+	OpcodeHelper(files, withOp(ops, name), outDir)
+	return nil
+}
 
-	for _, file := range files {
-		if file == "" {
-			continue
-		}
+func AddPortHelper(files []string, ops []Opcode, outDir string) {
+	OpcodeHelper(files, withOp(ops, "addport"), outDir)
+}
 
-		wg.Add(1)
-		go func(file string) {
-			defer wg.Done()
-			log.WithFields(log.Fields{
-				"file": file,
-			}).Debug("Processing file")
-			fileData, err := ioutil.ReadFile(file)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"file":  file,
-					"error": err,
-				}).Error("Error reading file")
-				return
-			}
+func RemovePortHelper(files []string, ops []Opcode, outDir string) {
+	OpcodeHelper(files, withOp(ops, "removeport"), outDir)
+}
 
-			fileContent := string(fileData)
+func TiePortHelper(files []string, ops []Opcode, outDir string) {
+	OpcodeHelper(files, withOp(ops, "tieport"), outDir)
+}
 
-			var newContent string
+func SetParamHelper(files []string, ops []Opcode, outDir string) {
+	OpcodeHelper(files, withOp(ops, "setparam"), outDir)
+}
 
-			switch f := funcHelper.(type) {
-			case TwoParamFunc:
-				newContent, err = f(fileContent, bw)
-			case ThreeParamFunc:
-				newContent, err = f(fileContent, bw, ew)
-			case FourParamFunc:
-				newContent, err = f(fileContent, bw, ew, repl)
-			default:
-				log.Errorf("Unsupported function type %T", f)
-				return
-			}
+// InstanceHelper applies the instance operation name (rminst, renameinst or
+// remaster) of the opcodes.
+func InstanceHelper(files []string, ops []Opcode, name string, outDir string) {
+	OpcodeHelper(files, withOp(ops, name), outDir)
+}
 
-			if err != nil {
-				log.WithFields(log.Fields{
-					"error":  err,
-					"action": funcDesc,
-				}).Error("Error processing content")
-				return
-			}
-			fileContent = newContent
-			outPath := outDir + "/" + file[strings.LastIndex(file, "/")+1:]
-			log.WithFields(log.Fields{
-				"outPath": outPath,
-			}).Debug("Writing modified content to output directory")
-			err = ioutil.WriteFile(outPath, []byte(fileContent), 0644)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"outPath": outPath,
-					"error":   err,
-				}).Error("Error writing modified content to output directory")
-				return
-			}
-		}(file)
-	}
-	wg.Wait()
+func RenameNetHelper(files []string, ops []Opcode, outDir string) {
+	OpcodeHelper(files, withOp(ops, "renamenet"), outDir)
 }
 
-func DeleteLineHelper(files []string, kw string, outDir string) {
-	ActionHelper(files, kw, "", "", outDir, TwoParamFunc(DeletelineAction), "delete line")
+func ReconnectHelper(files []string, ops []Opcode, outDir string) {
+	OpcodeHelper(files, withOp(ops, "reconnect"), outDir)
 }
 
-func RemoveHelper(files []string, bw string, ew string, outDir string) {
-	ActionHelper(files, bw, ew, "", outDir, ThreeParamFunc(RemoveAction), "remove")
+func RemoveHelper(files []string, ops []Opcode, outDir string) {
+	OpcodeHelper(files, withOp(ops, "remove"), outDir)
 }
 
-func DummyHelper(files []string, bw string, ew string, outDir string) {
-	ActionHelper(files, bw, ew, "", outDir, ThreeParamFunc(DummyAction), "dummy")
+func DummyHelper(files []string, ops []Opcode, outDir string) {
+	OpcodeHelper(files, withOp(ops, "dummy"), outDir)
 }
 
-func ReplaceHelper(files []string, bw string, ew string, repl string, outDir string) {
-	ActionHelper(files, bw, ew, repl, outDir, FourParamFunc(ReplaceAction), "replace")
+func ReplaceHelper(files []string, ops []Opcode, outDir string) {
+	OpcodeHelper(files, withOp(ops, "replace"), outDir)
 }
 
-func ChainHelper(configFile string, files []string, outDir string) {
+// withOp returns a copy of the opcodes with their operation set to name.
+func withOp(ops []Opcode, name string) []Opcode {
+	res := make([]Opcode, len(ops))
+	for i, op := range ops {
+		op.Op = name
+		res[i] = op
+	}
+	return res
+}
+
+// ChainHelper applies the opcodes of the config file. The defines and incDirs,
+// given like +define+ and +incdir+, are added to the ones of the config.
+func ChainHelper(configFile string, files []string, defines []string, incDirs []string, outDir string) {
 	var (
 		config Config
 		err    error
-		wg     sync.WaitGroup
 	)
 
 	log.WithFields(log.Fields{
@@ -381,11 +482,43 @@ func ChainHelper(configFile string, files []string, outDir string) {
 		return
 	}
 
+	pp := vpp.Config{
+		Defines: vpp.ParseDefines(append(config.Defines, defines...)),
+		IncDirs: append(config.IncDirs, incDirs...),
+	}
+	for i := range config.Opcode {
+		config.Opcode[i].PP = pp
+	}
+	OpcodeHelper(files, config.Opcode, outDir)
+}
+
+// Source is the content of one file of the processed set.
+type Source struct {
+	File    string
+	Content string
+}
+
+// setOps are the operations working on the whole file set at once.
+var setOps = map[string]func([]Source, Opcode) ([]Source, error){
+	"uniquify":   UniquifyAction,
+	"addport":    AddPortAction,
+	"removeport": RemovePortAction,
+	"tieport":    TiePortAction,
+	"setparam":   SetParamAction,
+	"rminst":     InstanceAction,
+	"renameinst": InstanceAction,
+	"remaster":   InstanceAction,
+	"reconnect":  ReconnectAction,
+}
+
+// OpcodeHelper applies the opcodes in order on every file and writes the
+// result into outDir.
+func OpcodeHelper(files []string, ops []Opcode, outDir string) {
 	log.WithFields(log.Fields{
 		"outDir": outDir,
 	}).Debug("Creating output directory")
 
-	if err = helper.CreateOutputDir(outDir); err != nil {
+	if err := helper.CreateOutputDir(outDir); err != nil {
 		log.WithFields(log.Fields{
 			"outDir": outDir,
 			"error":  err,
@@ -393,84 +526,151 @@ func ChainHelper(configFile string, files []string, outDir string) {
 		return
 	}
 
+	sources := readSources(files)
+	for _, op := range ops {
+		sources = applyOpcode(sources, op)
+	}
+
+	for _, src := range sources {
+		outPath := outDir + "/" + src.File[strings.LastIndex(src.File, "/")+1:]
+		log.WithFields(log.Fields{
+			"outPath": outPath,
+		}).Debug("Writing modified content to output directory")
+		err := ioutil.WriteFile(outPath, []byte(src.Content), 0644)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"outPath": outPath,
+				"error":   err,
+			}).Error("Error writing modified content to output directory")
+		}
+	}
+}
+
+// readSources reads the files, skipping the empty names and logging the files
+// which cannot be read.
+func readSources(files []string) []Source {
+	var sources []Source
 	for _, file := range files {
 		if file == "" {
 			continue
 		}
-
-		wg.Add(1)
-		go func(file string) {
-			defer wg.Done()
+		log.WithFields(log.Fields{
+			"file": file,
+		}).Debug("Processing file")
+		fileData, err := ioutil.ReadFile(file)
+		if err != nil {
 			log.WithFields(log.Fields{
-				"file": file,
-			}).Debug("Processing file")
-			fileData, err := ioutil.ReadFile(file)
-			if err != nil {
-				log.WithFields(log.Fields{
-					"file":  file,
-					"error": err,
-				}).Error("Error reading file")
-				return
-			}
+				"file":  file,
+				"error": err,
+			}).Error("Error reading file")
+			continue
+		}
+		sources = append(sources, Source{File: file, Content: string(fileData)})
+	}
+	return sources
+}
 
-			fileContent := string(fileData)
-
-			for _, op := range config.Opcode {
-				switch op.Op {
-				case "replace":
-					newContent, err := ReplaceAction(fileContent, op.Src, op.Begin, op.End)
-					if err != nil {
-						log.WithFields(log.Fields{
-							"op":     op,
-							"error":  err,
-							"action": "replace",
-						}).Error("Error replacing content")
-						continue
-					}
-					fileContent = newContent
-				case "dummy":
-					newContent, err := DummyAction(fileContent, op.Begin, op.End)
-					if err != nil {
-						log.WithFields(log.Fields{
-							"op":     op,
-							"error":  err,
-							"action": "dummy",
-						}).Error("Error dummying content")
-						continue
-					}
-					fileContent = newContent
-				case "remove":
-					newContent, err := RemoveAction(fileContent, op.Begin, op.End)
-					if err != nil {
-						log.WithFields(log.Fields{
-							"op":     op,
-							"error":  err,
-							"action": "remove",
-						}).Error("Error removing content")
-						continue
-					}
-					fileContent = newContent
-				case "deleteline":
-					newContent, _ := DeletelineAction(fileContent, op.Begin)
-					fileContent = newContent
-				default:
-					fmt.Printf("Unknown opcode: %s\n", op.Op)
-				}
+// applyOpcode applies one opcode on the file set, either at once or on each
+// file concurrently. The files failing the opcode are left unchanged.
+func applyOpcode(sources []Source, op Opcode) []Source {
+	cfg := op.PP
+	if len(op.Defines) > 0 {
+		cfg.Defines = vpp.ParseDefines(op.Defines)
+		for name, value := range op.PP.Defines {
+			if _, ok := cfg.Defines[name]; !ok {
+				cfg.Defines[name] = value
 			}
+		}
+	}
 
-			outPath := outDir + "/" + file[strings.LastIndex(file, "/")+1:]
+	switch {
+	case op.Preprocess:
+		pre, err := preprocessSources(sources, cfg)
+		if err != nil {
 			log.WithFields(log.Fields{
-				"outPath": outPath,
-			}).Debug("Writing modified content to output directory")
-			err = ioutil.WriteFile(outPath, []byte(fileContent), 0644)
+				"op":     op,
+				"error":  err,
+				"action": op.Op,
+			}).Error("Error preprocessing content")
+			return sources
+		}
+		return runOpcode(pre, op)
+	case len(op.Defines) > 0:
+		masked, inactive, err := maskSources(sources, cfg)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":     op,
+				"error":  err,
+				"action": op.Op,
+			}).Error("Error finding the inactive code")
+			return sources
+		}
+		res, err := unmaskSources(runOpcode(masked, op), inactive)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":     op,
+				"error":  err,
+				"action": op.Op,
+			}).Error("Error restoring the inactive code")
+			return sources
+		}
+		return res
+	}
+	return runOpcode(sources, op)
+}
+
+// runOpcode applies op on the sources, at once for the operations on the
+// file set, or on each file.
+func runOpcode(sources []Source, op Opcode) []Source {
+	if action, ok := setOps[op.Op]; ok {
+		res, err := action(sources, op)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"op":     op,
+				"error":  err,
+				"action": op.Op,
+			}).Error("Error processing content")
+			return sources
+		}
+		return res
+	}
+
+	var wg sync.WaitGroup
+	res := make([]Source, len(sources))
+	for i, src := range sources {
+		wg.Add(1)
+		go func(i int, src Source, op Opcode) {
+			defer wg.Done()
+			res[i] = src
+			op.File = src.File
+			newContent, err := OpcodeAction(src.Content, op)
 			if err != nil {
 				log.WithFields(log.Fields{
-					"outPath": outPath,
-					"error":   err,
-				}).Error("Error writing modified content to output directory")
+					"op":     op,
+					"file":   src.File,
+					"error":  err,
+					"action": op.Op,
+				}).Error("Error processing content")
 				return
 			}
-		}(file)
+			res[i].Content = newContent
+		}(i, src, op)
 	}
 	wg.Wait()
+	return res
+}
+
+// preprocessSources returns the preprocessed sources. They are one
+// compilation unit: the macros defined by a file are used by the next ones.
+func preprocessSources(sources []Source, cfg vpp.Config) ([]Source, error) {
+	pp := vpp.NewPreprocessor(cfg)
+	res := make([]Source, len(sources))
+	for i, src := range sources {
+		content, err := pp.Preprocess(src.Content, src.File)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = Source{File: src.File, Content: content}
+	}
+	return res, nil
 }
@@ -1,10 +1,15 @@
 package vtext
 
 import (
+	"encoding/json"
+	"os"
+	"strings"
 	"testing"
+
+	"github.com/zhuzhzh/vmod/internal/vpp"
 )
 
-func TestFindBeginEnd(t *testing.T) {
+func TestFindAllBeginEnd(t *testing.T) {
 	text := `This is some text with // a line <begin> comment
 // a line <end> comment
 and /* a block <begin> comment 
@@ -24,24 +29,315 @@ Here is the <begin> keyword.
 And here is the <end> keyword.`
 	t.Logf("text = \n%s\n", text)
 
-	beginIndex := 0
-	endIndex := 0
+	occurs := findAllBeginEnd(text, "<begin>", "<end>")
+	expect := []pIndex{{134, 209}, {231, 306}}
+
+	if len(occurs) != len(expect) {
+		t.Fatalf("Expected %d pairs, but got %d: %v", len(expect), len(occurs), occurs)
+	}
+	for i, pair := range occurs {
+		if pair != expect[i] {
+			t.Errorf("Expected pair %d to be %v, but got %v", i, expect[i], pair)
+		}
+		t.Logf("block %d = \n[%s]\n", i, text[pair.beginIndex:pair.endIndex])
+	}
+}
+
+func TestFindAllBeginEndWholeTokens(t *testing.T) {
+	text := `module or0010(a);
+  wire endmodule_cnt;
+  initial $display("module or001 endmodule");
+  (* note = "module or001" *) wire w;
+endmodule
+module  or001
+  (b);
+endmodule`
+
+	occurs := findAllBeginEnd(text, "module or001", "endmodule")
+	if len(occurs) != 1 {
+		t.Fatalf("Expected 1 pair, but got %d: %v", len(occurs), occurs)
+	}
+	got := text[occurs[0].beginIndex:occurs[0].endIndex]
+	expect := "module  or001\n  (b);\nendmodule"
+	if got != expect {
+		t.Errorf("Expected block\n[%s]\nbut got\n[%s]", expect, got)
+	}
+}
+
+func TestFindNestedBeginEnd(t *testing.T) {
+	text := `initial begin : outer
+  if (a) begin
+    fork
+      x = 1;
+      fork y = 2; join_none
+      wait fork;
+    join_any
+  end
+end
+initial begin b = 0; end`
+
+	occurs := findNestedBeginEnd(text, "begin", "end")
+	if len(occurs) != 2 {
+		t.Fatalf("Expected 2 pairs, but got %d: %v", len(occurs), occurs)
+	}
+	if got := text[occurs[0].beginIndex:occurs[0].endIndex]; got != text[8:strings.Index(text, "\ninitial begin b")] {
+		t.Errorf("Expected the outer block, but got\n[%s]", got)
+	}
+	if got := text[occurs[1].beginIndex:occurs[1].endIndex]; got != "begin b = 0; end" {
+		t.Errorf("Expected the second block, but got\n[%s]", got)
+	}
+
+	occurs = findNestedBeginEnd(text, "fork", "join")
+	if len(occurs) != 1 {
+		t.Fatalf("Expected 1 pair, but got %d: %v", len(occurs), occurs)
+	}
+	if got := text[occurs[0].beginIndex:occurs[0].endIndex]; !strings.HasSuffix(got, "wait fork;\n    join_any") {
+		t.Errorf("Expected the fork block to end on join_any, but got\n[%s]", got)
+	}
+
+	if occurs := findAllBeginEnd(text, "begin", "end"); text[occurs[0].beginIndex:occurs[0].endIndex] == text[8:strings.Index(text, "\ninitial begin b")] {
+		t.Errorf("Expected the plain search to stop at the first end")
+	}
+}
+
+func TestReplaceActionRegex(t *testing.T) {
+	dir := t.TempDir()
+	repl := dir + "/stub.v"
+	if err := os.WriteFile(repl, []byte("module ${cell}(); // ${kind}\nendmodule"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	text := `module tsmc_dff(q, d);
+endmodule
+// module tsmc_fake(); endmodule
+module tsmc_and2(z, a, b);
+endmodule
+module keep();
+endmodule
+`
+	op := Opcode{
+		Src:     repl,
+		BeginRe: `module\s+(?P<cell>tsmc_(?P<kind>\w+))`,
+		End:     "endmodule",
+		Marker:  "${cell} stubbed",
+	}
+	got, err := ReplaceAction(text, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `// replace tsmc_dff stubbed
+module tsmc_dff(); // dff
+endmodule
+// module tsmc_fake(); endmodule
+// replace tsmc_and2 stubbed
+module tsmc_and2(); // and2
+endmodule
+module keep();
+endmodule
+`
+	if got != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got)
+	}
+
+	op.Marker = ""
+	op.BeginRe = `module\s+keep\b`
+	got, err = RemoveAction(text, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "// remove module keep\n") || strings.Contains(got, "module keep()") {
+		t.Errorf("Expected module keep to be removed, but got\n[%s]", got)
+	}
+}
+
+func TestFindRegexBlocksNested(t *testing.T) {
+	text := "always begin if (a) begin b = 1; end c = 2; end\nalways begin d = 3; end"
+	occurs, err := findBlocks(text, Opcode{BeginRe: `\bbegin\b`, EndRe: `\bend\b`, Nested: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"begin if (a) begin b = 1; end c = 2; end", "begin d = 3; end"}
+	if len(occurs) != len(expect) {
+		t.Fatalf("Expected %d blocks, but got %d: %v", len(expect), len(occurs), occurs)
+	}
+	for i, b := range occurs {
+		if got := text[b.beginIndex:b.endIndex]; got != expect[i] {
+			t.Errorf("Expected block %d to be [%s], but got [%s]", i, expect[i], got)
+		}
+	}
+}
+
+func TestRemoveActionUnit(t *testing.T) {
+	text := `module  or001
+  (a);
+endmodule
+module /* c */ or002(); endmodule
+primitive or003 (o, i); output o; input i; table 0 : 0; endtable endprimitive
+module and001(); endmodule
+`
+	got, err := RemoveAction(text, Opcode{Unit: &Unit{Kind: "module", Name: "or*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `// remove module or001
+
+// remove module or002
+
+primitive or003 (o, i); output o; input i; table 0 : 0; endtable endprimitive
+module and001(); endmodule
+`
+	if got != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got)
+	}
+
+	got, err = RemoveAction(text, Opcode{Unit: &Unit{Name: "or003"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "or003 (o, i)") || !strings.Contains(got, "// remove primitive or003\n") {
+		t.Errorf("Expected primitive or003 to be removed, but got\n[%s]", got)
+	}
+}
 
-	for (beginIndex != -1) && (endIndex != -1) {
-		beginIndex, endIndex = findBeginEnd(text[endIndex:], "<begin>", "<end>")
-		t.Logf("beginIndex = %d, endIndex = %d\n", beginIndex, endIndex)
+func TestReplaceActionText(t *testing.T) {
+	var config Config
+	data := `{"opcode": [
+		{"op": "replace", "unit": {"name": "m"}, "text": ["module ${name}(); // ${VMOD_TEST_TAG}", "endmodule"]},
+		{"op": "replace", "unit": {"name": "m"}, "text": "module ${name}(); endmodule"}
+	]}`
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatal(err)
 	}
+	t.Setenv("VMOD_TEST_TAG", "stub")
 
-	expectBegin := 134
-	expectEnd := 209
+	text := "module m(input a);\nendmodule\n"
+	got, err := ReplaceAction(text, config.Opcode[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "// replace module m\nmodule m(); // stub\nendmodule\n"; got != expect {
+		t.Errorf("Expected %q, but got %q", expect, got)
+	}
+	got, err = ReplaceAction(text, config.Opcode[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "// replace module m\nmodule m(); endmodule\n"; got != expect {
+		t.Errorf("Expected %q, but got %q", expect, got)
+	}
 
-	if beginIndex != expectBegin {
-		t.Errorf("Expected beginIndex to be %d, but got %d", expectBegin, beginIndex)
+	if _, err := ReplaceAction(text, Opcode{Unit: &Unit{Name: "m"}}); err == nil {
+		t.Errorf("Expected an error without src and text")
+	}
+	if _, err := ReplaceAction(text, Opcode{Unit: &Unit{Name: "m"}, Src: t.TempDir() + "/missing.v"}); err == nil {
+		t.Errorf("Expected an error for a missing src file")
 	}
+}
 
-	if endIndex != expectEnd {
-		t.Errorf("Expected endIndex to be %d, but got %d", expectEnd, endIndex)
+func TestReplaceActionTemplate(t *testing.T) {
+	text := `module m #(parameter W = 8, localparam D = 2) (input [W-1:0] a, output q);
+endmodule
+module n(x);
+  input x;
+endmodule
+`
+	op := Opcode{
+		Unit: &Unit{Name: "*"},
+		Text: "module ${name}_wrap ${param_port_list}(\n  ${port_decls}\n);\n" +
+			"  ${name} ${param_value_assignment}u${index} (\n  ${port_conns}\n  ); // ${kind} ${ports} of ${file} (${params})\nendmodule",
+		File: "cells.v",
+	}
+	got, err := ReplaceAction(text, op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `// replace module m
+module m_wrap #(parameter W = 8) (
+  input [W-1:0] a,
+  output q
+);
+  m #(.W(W)) u0 (
+  .a(a),
+  .q(q)
+  ); // module a, q of cells.v (W)
+endmodule
+// replace module n
+module n_wrap (
+  input x
+);
+  n u1 (
+  .x(x)
+  ); // module x of cells.v ()
+endmodule
+`
+	if got != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got)
+	}
+}
+
+func TestReplaceActionSrcUnit(t *testing.T) {
+	lib := t.TempDir() + "/golden.v"
+	golden := "// golden cells\nprimitive udp_dff (q, d);\n  output q;\n  input d;\nendprimitive\n\nmodule and2_golden (input a, b, output z);\nendmodule\n"
+	if err := os.WriteFile(lib, []byte(golden), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var config Config
+	data := `{"opcode": [
+		{"op": "replace", "src": "` + lib + `", "unit": "udp_dff"},
+		{"op": "replace", "src": "` + lib + `", "unit": {"kind": "module", "name": "and2"}, "src_unit": "${name}_golden"}
+	]}`
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	text := "primitive udp_dff (q, d);\nendprimitive\nmodule and2 (a, b, z);\nendmodule\n"
+	for _, op := range config.Opcode {
+		var err error
+		if text, err = ReplaceAction(text, op); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := "// replace primitive udp_dff\nprimitive udp_dff (q, d);\n  output q;\n  input d;\nendprimitive\n" +
+		"// replace module and2\nmodule and2_golden (input a, b, output z);\nendmodule\n"
+	if text != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, text)
+	}
+
+	if _, err := ReplaceAction(text, Opcode{Src: lib, Unit: &Unit{Name: "or2"}, SrcUnit: "or2"}); err != nil {
+		t.Errorf("Expected no error without any or2 to replace, but got %v", err)
+	}
+	if _, err := ReplaceAction("module or2(); endmodule", Opcode{Src: lib, Unit: &Unit{Name: "or2"}}); err == nil {
+		t.Errorf("Expected an error for a unit missing from the library")
+	}
+}
+
+func TestApplyOpcodePreprocess(t *testing.T) {
+	sources := []Source{{"a.v", "`ifdef FPGA\n" +
+		"module ram (input clk);\n" +
+		"endmodule\n" +
+		"`else\n" +
+		"module ram (input clk, input se);\n" +
+		"endmodule\n" +
+		"`endif\n"}}
+	op := Opcode{Op: "remove", Unit: &Unit{Name: "ram"}, Preprocess: true,
+		PP: vpp.Config{Defines: map[string]string{"FPGA": ""}}}
+	res := applyOpcode(sources, op)
+	expect := "\n// remove module ram\n\n\n\n\n\n"
+	if res[0].Content != expect {
+		t.Errorf("Expected %q, got %q", expect, res[0].Content)
+	}
+}
+
+func TestApplyOpcodePreprocessFiles(t *testing.T) {
+	sources := []Source{
+		{"defs.v", "`define W 8\n"},
+		{"a.v", "module a (input [`W-1:0] d);\nendmodule\n"},
+	}
+	res := applyOpcode(sources, Opcode{Op: "rename", From: "b", To: "c", Preprocess: true})
+	if res[0].Content != "\n" {
+		t.Errorf("Expected the define to be dropped, got %q", res[0].Content)
+	}
+	expect := "module a (input [8-1:0] d);\nendmodule\n"
+	if res[1].Content != expect {
+		t.Errorf("Expected %q, got %q", expect, res[1].Content)
 	}
-	t.Logf("begin = \n[%s]\n", text[beginIndex:])
-	t.Logf("end = \n[%s]\n", text[endIndex:])
 }
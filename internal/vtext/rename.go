@@ -0,0 +1,134 @@
+package vtext
+
+import (
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zhuzhzh/vmod/internal/vlex"
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+// RenameAction renames the design unit op.From to op.To: its declaration,
+// its end label and the instances of it.
+func RenameAction(fileContent string, op Opcode) (string, error) {
+	log.WithFields(log.Fields{
+		"from": op.From,
+		"to":   op.To,
+	}).Debug("Renaming design unit")
+
+	if op.From == "" || op.To == "" {
+		return "", fmt.Errorf("missing from or to")
+	}
+	f := parseSource(fileContent, op.File)
+	if f.Unit(op.To) != nil && f.Unit(op.From) != nil {
+		return "", fmt.Errorf("%s is already declared", op.To)
+	}
+	return renameUnits(fileContent, f, map[string]string{op.From: op.To}), nil
+}
+
+// UniquifyAction adds op.Prefix and op.Suffix to the names of the modules and
+// primitives declared in the file set, and renames their instances. The
+// masters of the instances declared nowhere in the set are reported.
+func UniquifyAction(sources []Source, op Opcode) ([]Source, error) {
+	log.WithFields(log.Fields{
+		"prefix": op.Prefix,
+		"suffix": op.Suffix,
+	}).Debug("Uniquifying design units")
+
+	if op.Prefix == "" && op.Suffix == "" {
+		return nil, fmt.Errorf("missing prefix or suffix")
+	}
+	files := make([]*vparse.File, len(sources))
+	names := map[string]string{}
+	declared := map[string]bool{}
+	for i, src := range sources {
+		files[i] = parseSource(src.Content, src.File)
+		for _, u := range files[i].Units {
+			declared[u.Name] = true
+			if u.IsModule() || u.Kind == "primitive" {
+				names[u.Name] = op.Prefix + u.Name + op.Suffix
+			}
+		}
+	}
+
+	res := make([]Source, len(sources))
+	for i, src := range sources {
+		res[i] = Source{File: src.File, Content: renameUnits(src.Content, files[i], names)}
+	}
+
+	if unresolved := unresolvedMasters(files, declared); len(unresolved) > 0 {
+		log.WithFields(log.Fields{
+			"masters": unresolved,
+		}).Warn("Instances of units declared out of the file set are not renamed")
+	}
+	return res, nil
+}
+
+// parseSource parses the content of file, logging the parse error and keeping
+// the units parsed so far.
+func parseSource(content string, file string) *vparse.File {
+	f, err := vparse.Parse(content)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"file":  file,
+			"error": err,
+		}).Warn("Working on the units parsed so far")
+	}
+	return f
+}
+
+// renameUnits renames the declarations, end labels and instances of the
+// units of f, parsed from src, to their name in names.
+func renameUnits(src string, f *vparse.File, names map[string]string) string {
+	var edits []edit
+	for _, u := range f.Units {
+		if to, ok := names[u.Name]; ok {
+			edits = append(edits, edit{u.NameSpan, identText(to)})
+			if label := endLabel(src, u); !label.Empty() {
+				edits = append(edits, edit{label, identText(to)})
+			}
+		}
+		for i, inst := range u.Instances {
+			// the instances of one statement share the master
+			if i > 0 && inst.Stmt == u.Instances[i-1].Stmt {
+				continue
+			}
+			if to, ok := names[inst.Master]; ok {
+				edits = append(edits, edit{inst.MasterSpan, identText(to)})
+			}
+		}
+	}
+	return applyEdits(src, edits)
+}
+
+// unresolvedMasters returns the sorted masters of the instances of files
+// which are neither declared nor built-in gates.
+func unresolvedMasters(files []*vparse.File, declared map[string]bool) []string {
+	seen := map[string]bool{}
+	var res []string
+	for _, f := range files {
+		for _, u := range f.Units {
+			for _, inst := range u.Instances {
+				if declared[inst.Master] || seen[inst.Master] || vlex.IsKeyword(inst.Master) {
+					continue
+				}
+				seen[inst.Master] = true
+				res = append(res, inst.Master)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// endLabel returns the span of the label following the end keyword of u, if
+// any.
+func endLabel(src string, u *vparse.Unit) vparse.Span {
+	toks := vlex.Significant(vlex.Lex(u.EndSpan.Text(src)))
+	if len(toks) == 3 && toks[1].Is(":") && toks[2].IsIdent() {
+		start := u.EndSpan.Start + toks[2].Pos
+		return vparse.Span{Start: start, End: start + len(toks[2].Text)}
+	}
+	return vparse.Span{}
+}
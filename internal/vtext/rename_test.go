@@ -0,0 +1,67 @@
+package vtext
+
+import (
+	"testing"
+
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+func TestRenameAction(t *testing.T) {
+	text := `module foo (input a, output foo_q);
+endmodule : foo
+
+module top;
+  wire foo, foo_sig;
+  foo u_foo (.a(foo), .foo_q(foo_sig));
+  foo #(.W(1)) u0 (foo, ), u1 (foo, );
+  // foo in a comment
+endmodule
+`
+	got, err := RenameAction(text, Opcode{From: "foo", To: "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `module bar (input a, output foo_q);
+endmodule : bar
+
+module top;
+  wire foo, foo_sig;
+  bar u_foo (.a(foo), .foo_q(foo_sig));
+  bar #(.W(1)) u0 (foo, ), u1 (foo, );
+  // foo in a comment
+endmodule
+`
+	if got != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got)
+	}
+
+	if _, err := RenameAction(text, Opcode{From: "foo", To: "top"}); err == nil {
+		t.Errorf("Expected an error when renaming to a declared module")
+	}
+}
+
+func TestUniquifyAction(t *testing.T) {
+	sources := []Source{
+		{"a.v", "module sync_ff (input d, output q);\n  dff_cell u (d, q);\nendmodule : sync_ff\n"},
+		{"b.v", "module top;\n  wire sync_ff;\n  sync_ff u0 (.d(sync_ff));\n  bus_if bus ();\n  and (x, y, z);\nendmodule\ninterface bus_if; endinterface\n"},
+	}
+	got, err := UniquifyAction(sources, Opcode{Prefix: "ip1_"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"module ip1_sync_ff (input d, output q);\n  dff_cell u (d, q);\nendmodule : ip1_sync_ff\n",
+		"module ip1_top;\n  wire sync_ff;\n  ip1_sync_ff u0 (.d(sync_ff));\n  bus_if bus ();\n  and (x, y, z);\nendmodule\ninterface bus_if; endinterface\n",
+	}
+	for i, e := range expect {
+		if got[i].File != sources[i].File || got[i].Content != e {
+			t.Errorf("Expected %s\n[%s]\nbut got %s\n[%s]", sources[i].File, e, got[i].File, got[i].Content)
+		}
+	}
+
+	files := []*vparse.File{parseSource(sources[0].Content, ""), parseSource(sources[1].Content, "")}
+	declared := map[string]bool{"sync_ff": true, "top": true, "bus_if": true}
+	if unresolved := unresolvedMasters(files, declared); len(unresolved) != 1 || unresolved[0] != "dff_cell" {
+		t.Errorf("Expected dff_cell to be unresolved, but got %v", unresolved)
+	}
+}
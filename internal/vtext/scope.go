@@ -0,0 +1,70 @@
+package vtext
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zhuzhzh/vmod/internal/vpp"
+)
+
+// maskSources returns the sources with the inactive code under cfg replaced
+// by placeholder comments, so the operations neither match nor parse it, and
+// the original text of the placeholders of every file. Like for the
+// preprocessed sources, the macros defined by a file are used by the next ones.
+func maskSources(sources []Source, cfg vpp.Config) ([]Source, map[string][]string, error) {
+	pp := vpp.NewPreprocessor(cfg)
+	masked := make([]Source, len(sources))
+	inactive := map[string][]string{}
+	for i, src := range sources {
+		spans, err := pp.Inactive(src.Content, src.File)
+		if err != nil {
+			return nil, nil, err
+		}
+		var b strings.Builder
+		var start int
+		for k, span := range spans {
+			text := src.Content[span.Start:span.End]
+			b.WriteString(src.Content[start:span.Start])
+			b.WriteString(placeholder(k, text))
+			inactive[src.File] = append(inactive[src.File], text)
+			start = span.End
+		}
+		b.WriteString(src.Content[start:])
+		masked[i] = Source{File: src.File, Content: b.String()}
+	}
+	return masked, inactive, nil
+}
+
+// unmaskSources puts the inactive code back in place of the placeholders
+// left by the operation, which may have copied them. It fails when a
+// placeholder is gone, since its inactive code would be lost.
+func unmaskSources(sources []Source, inactive map[string][]string) ([]Source, error) {
+	res := make([]Source, len(sources))
+	for i, src := range sources {
+		res[i] = src
+		for k, text := range inactive[src.File] {
+			mark := placeholder(k, text)
+			if !strings.Contains(res[i].Content, mark) {
+				return nil, fmt.Errorf("%s: the operation dropped the inactive code at %q", src.File, firstLine(text))
+			}
+			res[i].Content = strings.ReplaceAll(res[i].Content, mark, text)
+		}
+	}
+	return res, nil
+}
+
+// firstLine returns the first non-blank line of text, trimmed.
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// placeholder returns the comment standing for the inactive text number k.
+// It keeps the line breaks of the text so the lines do not move.
+func placeholder(k int, text string) string {
+	return fmt.Sprintf("/*rtlmod:inactive:%d%s*/", k, strings.Repeat("\n", strings.Count(text, "\n")))
+}
@@ -0,0 +1,62 @@
+package vtext
+
+import (
+	"testing"
+)
+
+func TestApplyOpcodeDefines(t *testing.T) {
+	asic := "module ram (input clk, input se, output [7:0] q);\n" +
+		"  sram_macro u_mem (.CLK(clk), .SE(se), .Q(q));\n" +
+		"endmodule\n"
+	src := "`timescale 1ns/1ps\n" +
+		"`ifdef FPGA\n" +
+		"module ram (input clk, input se, output [7:0] q);\n" +
+		"  bram u_mem (.clk(clk), .q(q));\n" +
+		"endmodule\n" +
+		"`else\n" +
+		asic +
+		"`endif\n"
+	sources := []Source{{"ram.v", src}}
+
+	res := applyOpcode(sources, Opcode{Op: "dummy", Unit: &Unit{Name: "ram"}, Defines: []string{"FPGA"}})
+	expect := "`timescale 1ns/1ps\n" +
+		"`ifdef FPGA\n" +
+		"// dummy module ram\n" +
+		"module ram (input clk, input se, output [7:0] q);\n" +
+		"endmodule\n" +
+		"`else\n" +
+		asic +
+		"`endif\n"
+	if res[0].Content != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, res[0].Content)
+	}
+
+	res = applyOpcode(sources, Opcode{Op: "rename", From: "bram", To: "bram_fixed", Defines: []string{"ASIC"}})
+	if res[0].Content != src {
+		t.Errorf("Expected the inactive branch to be left alone, got\n%s", res[0].Content)
+	}
+}
+
+func TestApplyOpcodeDefinesPlaceholders(t *testing.T) {
+	unit := "module top;\n" +
+		"`ifdef FPGA\n" +
+		"  bram u_mem ();\n" +
+		"`else\n" +
+		"  sram u_mem ();\n" +
+		"`endif\n" +
+		"endmodule"
+	sources := []Source{{"top.v", unit + "\n"}}
+
+	// every copy of the inactive code is restored
+	res := applyOpcode(sources, Opcode{Op: "replace", Unit: &Unit{Name: "top"}, Text: "${match}\n${match}", Defines: []string{"FPGA"}})
+	expect := "// replace module top\n" + unit + "\n" + unit + "\n"
+	if res[0].Content != expect {
+		t.Errorf("Expected\n%s\ngot\n%s", expect, res[0].Content)
+	}
+
+	// the file is left alone when the inactive code would be lost
+	res = applyOpcode(sources, Opcode{Op: "remove", Unit: &Unit{Name: "top"}, Defines: []string{"FPGA"}})
+	if res[0].Content != sources[0].Content {
+		t.Errorf("Expected the file to be left alone, got\n%s", res[0].Content)
+	}
+}
@@ -0,0 +1,273 @@
+package vtext
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zhuzhzh/vmod/internal/vlex"
+	"github.com/zhuzhzh/vmod/internal/vparse"
+)
+
+// tieValues maps the tie modes to the value driven on the outputs. The
+// unsized literals extend to the width of any port.
+var tieValues = map[string]string{
+	"zero": "'b0",
+	"one":  "~'b0",
+	"x":    "'bx",
+	"z":    "'bz",
+}
+
+// TiePassthrough drives each output from the input with the same name once
+// the direction affixes are stripped, e.g. data_o from data_i.
+const TiePassthrough = "passthrough-by-name"
+
+var (
+	outAffixes = []string{"_o", "_out", "o_", "out_"}
+	inAffixes  = []string{"_i", "_in", "i_", "in_"}
+)
+
+// blackboxProfiles maps the synthesis tools to the attribute or pragma
+// marking a unit as a black box.
+var blackboxProfiles = map[string]string{
+	"yosys":    "(* blackbox *)",
+	"vivado":   "(* black_box = \"yes\" *)",
+	"synplify": "(* syn_black_box *)",
+	"synopsys": "// synopsys black_box",
+}
+
+// blackboxText returns the attribute or pragma of the profile, which may also
+// be given literally as an attribute or a comment.
+func blackboxText(profile string) (string, error) {
+	if text, ok := blackboxProfiles[profile]; ok {
+		return text, nil
+	}
+	for _, prefix := range []string{"(*", "//", "/*"} {
+		if strings.HasPrefix(profile, prefix) {
+			return profile, nil
+		}
+	}
+	return "", fmt.Errorf("unknown black box profile %q, expect yosys, vivado, synplify, synopsys or an attribute", profile)
+}
+
+func checkTie(tie string) error {
+	if _, ok := tieValues[tie]; ok || tie == "" || tie == TiePassthrough {
+		return nil
+	}
+	return fmt.Errorf("unknown tie mode %q, expect zero, one, x, z or %s", tie, TiePassthrough)
+}
+
+// stubText returns the black-box version of the design unit u declared in
+// src: the black box attributes of op.Blackbox, the header as written, with
+// its parameter and port lists, the black box pragmas, the body parameters, the
+// port declarations of non-ANSI ports with the net or variable declarations
+// giving their type and width, the tie-off of the outputs selected by
+// op.Tie, and the end keyword.
+func stubText(src string, u *vparse.Unit, op Opcode) string {
+	var b strings.Builder
+	var pragmas []string
+	for _, profile := range op.Blackbox {
+		// checked by DummyAction
+		text, _ := blackboxText(profile)
+		if strings.HasPrefix(text, "(*") {
+			b.WriteString(text + "\n")
+		} else {
+			pragmas = append(pragmas, text)
+		}
+	}
+	b.WriteString(u.Header.Text(src))
+	b.WriteString("\n")
+	indent := "  "
+	for _, text := range pragmas {
+		b.WriteString(indent + text + "\n")
+	}
+	params := keptParams(src, u)
+	for _, d := range u.Decls {
+		if !isPortDecl(u, d) && !isPortNetDecl(u, d) && !params[d] {
+			continue
+		}
+		indent = lineIndent(src, d.Span.Start)
+		b.WriteString(indent)
+		b.WriteString(d.Span.Text(src))
+		b.WriteString("\n")
+	}
+	if op.Tie != "" {
+		for _, line := range tieLines(u, op.Tie) {
+			b.WriteString(indent + line + "\n")
+		}
+	}
+	b.WriteString(u.EndSpan.Text(src))
+	return b.String()
+}
+
+// tieLines returns the statements driving every output of u. Variables
+// cannot be driven by an assign in Verilog, so they get a procedural
+// assignment instead.
+func tieLines(u *vparse.Unit, tie string) []string {
+	var lines []string
+	for _, port := range u.Ports {
+		if port.Dir != "output" || port.Name == "" {
+			continue
+		}
+		value := tieValues[tie]
+		if tie == TiePassthrough {
+			if in := passthroughInput(u, port); in != nil {
+				value = identText(in.Name)
+			} else {
+				log.WithFields(log.Fields{
+					"unit": u.Name,
+					"port": port.Name,
+				}).Warn("No input to pass through, tying the output to zero")
+				value = tieValues["zero"]
+			}
+		}
+		name := identText(port.Name)
+		switch {
+		case !isVariable(port.Type):
+			lines = append(lines, "assign "+name+" = "+value+";")
+		case tie == TiePassthrough && value != tieValues["zero"]:
+			lines = append(lines, "always @* "+name+" = "+value+";")
+		default:
+			lines = append(lines, "initial "+name+" = "+value+";")
+		}
+	}
+	return lines
+}
+
+// passthroughInput returns the input of u matching the output port by name.
+func passthroughInput(u *vparse.Unit, out *vparse.Port) *vparse.Port {
+	base := trimAffix(out.Name, outAffixes)
+	for _, port := range u.Ports {
+		if port.Dir == "input" && port != out && trimAffix(port.Name, inAffixes) == base {
+			return port
+		}
+	}
+	return nil
+}
+
+// trimAffix strips the first matching suffix or prefix from name.
+func trimAffix(name string, affixes []string) string {
+	lower := strings.ToLower(name)
+	for _, a := range affixes {
+		if strings.HasPrefix(a, "_") && strings.HasSuffix(lower, a) && len(name) > len(a) {
+			return lower[:len(lower)-len(a)]
+		}
+		if strings.HasSuffix(a, "_") && strings.HasPrefix(lower, a) && len(name) > len(a) {
+			return lower[len(a):]
+		}
+	}
+	return lower
+}
+
+// isVariable reports whether the data type declares a variable rather than a
+// net.
+func isVariable(typ string) bool {
+	switch strings.Fields(typ + " _")[0] {
+	case "reg", "integer", "time", "real", "realtime":
+		return true
+	}
+	return false
+}
+
+// identText returns name as it is written in the source, escaping it when it
+// is not a simple identifier.
+func identText(name string) string {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !(c == '_' || c == '$' && i > 0 || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' && i > 0) {
+			return "\\" + name + " "
+		}
+	}
+	if vlex.IsKeyword(name) {
+		return "\\" + name + " "
+	}
+	return name
+}
+
+// keptParams returns the parameter declarations of the body the stub keeps:
+// every parameter, since instances may override it, and the localparams the
+// header, the port declarations or the other kept declarations refer to.
+func keptParams(src string, u *vparse.Unit) map[*vparse.Decl]bool {
+	kept := map[*vparse.Decl]bool{}
+	used := map[string]bool{}
+	addIdents(used, u.Header.Text(src))
+	for _, d := range u.Decls {
+		switch {
+		case isPortDecl(u, d) || isPortNetDecl(u, d):
+			addIdents(used, d.Span.Text(src))
+		case d.Kind == "parameter":
+			kept[d] = true
+			addIdents(used, d.Span.Text(src))
+		}
+	}
+
+	// a localparam may depend on a later one, repeat until nothing changes
+	for changed := true; changed; {
+		changed = false
+		for _, d := range u.Decls {
+			if d.Kind != "localparam" || kept[d] {
+				continue
+			}
+			for _, v := range d.Vars {
+				if used[v.Name] {
+					kept[d] = true
+					addIdents(used, d.Span.Text(src))
+					changed = true
+					break
+				}
+			}
+		}
+	}
+	return kept
+}
+
+// addIdents adds the names of the identifiers of text to set.
+func addIdents(set map[string]bool, text string) {
+	for _, tok := range vlex.Lex(text) {
+		if tok.IsIdent() {
+			set[tok.Name()] = true
+		}
+	}
+}
+
+// isPortDecl reports whether d is the direction declaration of ports of u.
+func isPortDecl(u *vparse.Unit, d *vparse.Decl) bool {
+	switch d.Kind {
+	case "input", "output", "inout", "ref":
+	default:
+		return false
+	}
+	for _, v := range d.Vars {
+		if u.Port(v.Name) == nil {
+			return false
+		}
+	}
+	return len(d.Vars) > 0
+}
+
+// isPortNetDecl reports whether d is a net or variable declaration of ports
+// of the non-ANSI unit u, which gives their type and width, like
+// "reg [3:0] q;".
+func isPortNetDecl(u *vparse.Unit, d *vparse.Decl) bool {
+	switch d.Kind {
+	case "input", "output", "inout", "ref", "parameter", "localparam":
+		return false
+	}
+	for _, v := range d.Vars {
+		if !u.ANSI && u.Port(v.Name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// lineIndent returns the whitespace between the start of the line and pos,
+// or "" when something else precedes pos on its line.
+func lineIndent(src string, pos int) string {
+	start := strings.LastIndexByte(src[:pos], '\n') + 1
+	indent := src[start:pos]
+	if strings.TrimLeft(indent, " \t") != "" {
+		return ""
+	}
+	return indent
+}
@@ -0,0 +1,161 @@
+package vtext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDummyActionStub(t *testing.T) {
+	text := `module ansi #(parameter W = 8) (
+  input  wire [W-1:0] a,
+  // the result, this comment mentions output
+  output reg  [W-1:0] q
+);
+  always @(posedge a[0]) q <= a;
+endmodule
+
+module old(a, b,
+           c);
+  input [3:0] a;
+  input b;
+  output c;
+  reg c;
+  function f(input x); f = x; endfunction
+  always @* c = b;
+endmodule
+`
+	got, err := DummyAction(text, Opcode{Unit: &Unit{Kind: "module", Name: "*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `// dummy module ansi
+module ansi #(parameter W = 8) (
+  input  wire [W-1:0] a,
+  // the result, this comment mentions output
+  output reg  [W-1:0] q
+);
+endmodule
+
+// dummy module old
+module old(a, b,
+           c);
+  input [3:0] a;
+  input b;
+  output c;
+  reg c;
+endmodule
+`
+	if got != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got)
+	}
+
+	got, err = DummyAction(text, Opcode{Begin: "module old", End: "endmodule"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(got, "// dummy module old...endmodule\nmodule old(a, b,\n           c);\n  input [3:0] a;\n  input b;\n  output c;\n  reg c;\nendmodule\n") {
+		t.Errorf("Expected the begin/end block to be stubbed the same way, but got\n[%s]", got)
+	}
+}
+
+func TestDummyActionTie(t *testing.T) {
+	text := `module ansi (input [7:0] data_i, input en, output [7:0] data_o, output reg valid_o, output busy);
+endmodule
+
+module old(i_a, o_a, o_q, o_r);
+  input i_a;
+  output o_a;
+  output reg o_q;
+  output o_r;
+  reg o_r;
+endmodule
+`
+	ties := []struct {
+		tie    string
+		expect []string
+	}{
+		{"one", []string{"assign data_o = ~'b0;", "initial valid_o = ~'b0;", "assign busy = ~'b0;", "assign o_a = ~'b0;", "initial o_q = ~'b0;", "initial o_r = ~'b0;"}},
+		{"passthrough-by-name", []string{"assign data_o = data_i;", "initial valid_o = 'b0;", "assign busy = 'b0;", "  assign o_a = i_a;"}},
+	}
+	for _, e := range ties {
+		got, err := DummyAction(text, Opcode{Unit: &Unit{Name: "*"}, Tie: e.tie})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range e.expect {
+			if !strings.Contains(got, line+"\n") {
+				t.Errorf("tie %s: expected %q in\n%s", e.tie, line, got)
+			}
+		}
+	}
+
+	if _, err := DummyAction(text, Opcode{Unit: &Unit{Name: "*"}, Tie: "high"}); err == nil {
+		t.Errorf("Expected an error for an unknown tie mode")
+	}
+}
+
+func TestDummyActionParams(t *testing.T) {
+	text := `module old(a, q);
+  parameter WIDTH = 8;
+  localparam MSB = LAST;
+  localparam LAST = WIDTH - 1;
+  localparam UNUSED = 3;
+  input [MSB:0] a;
+  output q;
+  wire [UNUSED:0] n;
+endmodule
+`
+	got, err := DummyAction(text, Opcode{Unit: &Unit{Name: "old"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `// dummy module old
+module old(a, q);
+  parameter WIDTH = 8;
+  localparam MSB = LAST;
+  localparam LAST = WIDTH - 1;
+  input [MSB:0] a;
+  output q;
+endmodule
+`
+	if got != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got)
+	}
+}
+
+func TestDummyActionBlackbox(t *testing.T) {
+	text := "module m (input a);\n  wire b;\nendmodule\n"
+	got, err := DummyAction(text, Opcode{Unit: &Unit{Name: "m"}, Blackbox: []string{"vivado", "synopsys", "(* keep *)"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "// dummy module m\n(* black_box = \"yes\" *)\n(* keep *)\nmodule m (input a);\n  // synopsys black_box\nendmodule\n"
+	if got != expect {
+		t.Errorf("Expected\n[%s]\nbut got\n[%s]", expect, got)
+	}
+
+	if _, err := DummyAction(text, Opcode{Unit: &Unit{Name: "m"}, Blackbox: []string{"quartus"}}); err == nil {
+		t.Errorf("Expected an error for an unknown profile")
+	}
+}
+
+func TestDummyActionPortTypes(t *testing.T) {
+	text := `module old(a, q);
+  localparam W = 4;
+  input a;
+  output q;
+  wire [7:0] a;
+  reg [W-1:0] q;
+  reg [W-1:0] state;
+  always @(posedge a[0]) q <= state;
+endmodule
+`
+	got, err := DummyAction(text, Opcode{Unit: &Unit{Name: "old"}, Tie: "zero"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "module old(a, q);\n  localparam W = 4;\n  input a;\n  output q;\n  wire [7:0] a;\n  reg [W-1:0] q;\n  initial q = 'b0;\nendmodule"
+	if !strings.Contains(got, expect) {
+		t.Errorf("Expected the types and widths of the ports to be kept in\n%s", got)
+	}
+}
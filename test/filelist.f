@@ -1 +1 @@
-./test/lib.v
+lib.v